@@ -0,0 +1,240 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type AggregateFunction string
+const (
+	AggregateFunction_UNDEF AggregateFunction = ""
+	AggregateFunction_COUNT AggregateFunction = "count"
+	AggregateFunction_SUM AggregateFunction = "sum"
+	AggregateFunction_AVG AggregateFunction = "avg"
+	AggregateFunction_MIN AggregateFunction = "min"
+	AggregateFunction_MAX AggregateFunction = "max"
+)
+
+// A metric computed over each group of entries, e.g. "avg(age)".
+type Metric struct {
+	Function AggregateFunction
+	// The aggregated field, or "*" to count the entries of a group.
+	Field string
+}
+
+// The key holding the value of the metric in the aggregate results.
+func (m Metric) Name () string {
+	return fmt.Sprintf("%s(%s)", m.Function, m.Field)
+}
+
+type AggregateQuery struct {
+	// The fields the entries are grouped by. If empty, the metrics are
+	// computed over all the matching entries.
+	GroupBy []string
+	Metrics []Metric
+	// Only the entries matching every constraint are aggregated.
+	Constraints []Constraint
+}
+
+var _metricPattern = regexp.MustCompile(`^\s*([a-zA-Z]+)\s*\(\s*([^()\s]+)\s*\)\s*$`)
+
+// Parse a metric, e.g. "count(*)" or "avg(age)".
+func parse_metric (metric string) (Metric, error) {
+	match := _metricPattern.FindStringSubmatch(metric)
+	if match == nil { return Metric{}, ValidationErrorf("invalid_metric", "invalid metric \"%s\", expected \"function(field)\"", metric).WithField("metrics", "invalid metric") }
+
+	function := AggregateFunction(strings.ToLower(match[1]))
+	switch function {
+	case AggregateFunction_COUNT, AggregateFunction_SUM, AggregateFunction_AVG, AggregateFunction_MIN, AggregateFunction_MAX:
+	default:
+		return Metric{}, ValidationErrorf("invalid_metric", "unknown aggregate function \"%s\"", match[1]).WithField("metrics", "unknown aggregate function")
+	}
+	if match[2] == "*" && function != AggregateFunction_COUNT {
+		return Metric{}, ValidationErrorf("invalid_metric", "only count accepts \"*\", received \"%s\"", metric).WithField("metrics", "only count accepts \"*\"")
+	}
+	return Metric{ Function: function, Field: match[2] }, nil
+}
+
+// Split a comma separated url parameter, ignoring empty elements.
+func split_list_param (route_params *UrlParams, key string) []string {
+	value, err := route_params.Get(key)
+	if err != nil { return []string{} }
+	parts := []string{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) > 0 { parts = append(parts, part) }
+	}
+	return parts
+}
+
+// Parse the "group_by" and "metrics" url parameters, the other parameters are
+// constraints. The metrics default to "count(*)".
+func parse_aggregate_query (route_params *UrlParams) (*AggregateQuery, error) {
+	query := &AggregateQuery{ GroupBy: split_list_param(route_params, "group_by") }
+
+	for _, m := range split_list_param(route_params, "metrics") {
+		metric, err := parse_metric(m)
+		if err != nil { return nil, err }
+		query.Metrics = append(query.Metrics, metric)
+	}
+	if len(query.Metrics) == 0 {
+		query.Metrics = []Metric{{ Function: AggregateFunction_COUNT, Field: "*" }}
+	}
+
+	constraints, err := parse_constraints(route_params, "group_by", "metrics")
+	if err != nil { return nil, err }
+	query.Constraints = constraints
+	return query, nil
+}
+
+// Check that the fields of `query` exist in `schema` and that their types
+// support the requested metrics.
+func validate_aggregate_query (query *AggregateQuery, schema *Schema) error {
+	if len(schema.Fields) == 0 {
+		return ValidationErrorf("unsupported_route", "aggregating \"%s\" requires its fields to be declared", schema.Name)
+	}
+
+	lookup := func (name string) (*Field, error) {
+		field := schema.Field(name)
+		if field == nil { return nil, ValidationErrorf("unknown_field", "unknown field \"%s\"", name).WithField(name, "unknown field") }
+		return field, nil
+	}
+	for _, name := range query.GroupBy {
+		field, err := lookup(name)
+		if err != nil { return err }
+		if field.Type == FieldType_JSON || field.Type == FieldType_BLOB {
+			return ValidationErrorf("invalid_field_type", "cannot group by field \"%s\" of type json or blob", name).WithField(name, "cannot group by a json or blob field")
+		}
+	}
+	for _, metric := range query.Metrics {
+		if metric.Field == "*" { continue }
+		field, err := lookup(metric.Field)
+		if err != nil { return err }
+		switch metric.Function {
+		case AggregateFunction_SUM, AggregateFunction_AVG:
+			if !field.Type.IsNumeric() {
+				return ValidationErrorf("invalid_field_type", "%s requires a numeric field, \"%s\" is not", metric.Function, metric.Field).WithField(metric.Field, "not numeric")
+			}
+		case AggregateFunction_MIN, AggregateFunction_MAX:
+			if field.Type == FieldType_JSON || field.Type == FieldType_BLOB {
+				return ValidationErrorf("invalid_field_type", "%s cannot be computed over the json or blob field \"%s\"", metric.Function, metric.Field).WithField(metric.Field, "json or blob field")
+			}
+		}
+	}
+	for _, constraint := range query.Constraints {
+		if _, err := lookup(constraint.Property); err != nil { return err }
+	}
+	return nil
+}
+
+// Convert a stored value to a float for sum and avg, accepting numbers held
+// as strings.
+func numeric_value (value interface{}) (float64, bool) {
+	if number, ok := as_number(value); ok { return number, true }
+	if s, ok := value.(string); ok {
+		number, err := strconv.ParseFloat(s, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// Compute `metric` over the entries of a group. Like in SQL, null values
+// are ignored and metrics of groups without values are null.
+func compute_metric (metric Metric, entries []map[string]interface{}) interface{} {
+	if metric.Function == AggregateFunction_COUNT {
+		count := 0
+		for _, entry := range entries {
+			if metric.Field == "*" || entry[metric.Field] != nil { count++ }
+		}
+		return count
+	}
+
+	var result interface{}
+	var sum float64
+	var n int
+	for _, entry := range entries {
+		value := entry[metric.Field]
+		if value == nil { continue }
+		switch metric.Function {
+		case AggregateFunction_SUM, AggregateFunction_AVG:
+			number, ok := numeric_value(value)
+			if !ok { continue }
+			sum += number
+			n++
+		case AggregateFunction_MIN:
+			if result == nil || compare_values(value, fmt.Sprint(result)) < 0 { result = value }
+		case AggregateFunction_MAX:
+			if result == nil || compare_values(value, fmt.Sprint(result)) > 0 { result = value }
+		}
+	}
+	switch metric.Function {
+	case AggregateFunction_SUM:
+		if n == 0 { return nil }
+		return sum
+	case AggregateFunction_AVG:
+		if n == 0 { return nil }
+		return sum / float64(n)
+	}
+	return result
+}
+
+// Aggregate `entries` in process. Groups are ordered by their values.
+func aggregate_entries (entries []map[string]interface{}, query *AggregateQuery) []map[string]interface{} {
+	type group struct {
+		values []interface{}
+		entries []map[string]interface{}
+	}
+	groups := map[string]*group{}
+	keys := []string{}
+	if len(query.GroupBy) == 0 {
+		// Without grouping, a single row is returned even if nothing matches.
+		groups[""] = &group{}
+		keys = append(keys, "")
+	}
+	for _, entry := range entries {
+		if !matches_constraints(entry, query.Constraints) { continue }
+		values := []interface{}{}
+		key := ""
+		for _, field := range query.GroupBy {
+			values = append(values, entry[field])
+			key += fmt.Sprintf("%#v;", entry[field])
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{ values: values }
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.entries = append(g.entries, entry)
+	}
+
+	sort.SliceStable(keys, func (i, j int) bool {
+		a, b := groups[keys[i]].values, groups[keys[j]].values
+		for k := range a {
+			// Null values come first, like in MySQL.
+			if a[k] == nil || b[k] == nil {
+				if (a[k] == nil) != (b[k] == nil) { return a[k] == nil }
+				continue
+			}
+			if cmp := compare_values(a[k], fmt.Sprint(b[k])); cmp != 0 { return cmp < 0 }
+		}
+		return false
+	})
+
+	results := []map[string]interface{}{}
+	for _, key := range keys {
+		g := groups[key]
+		row := map[string]interface{}{}
+		for i, field := range query.GroupBy {
+			row[field] = g.values[i]
+		}
+		for _, metric := range query.Metrics {
+			row[metric.Name()] = compute_metric(metric, g.entries)
+		}
+		results = append(results, row)
+	}
+	return results
+}
@@ -0,0 +1,25 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAggregateQuery (t *testing.T) {
+	params, err := parse_route_params("group_by=location,%20name&metrics=COUNT(*),%20avg(age)&age=-notnull")
+	assert.NoError(t, err)
+	query, err := parse_aggregate_query(params)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ "location", "name" }, query.GroupBy)
+	assert.Equal(t, []Metric{
+		{ Function: AggregateFunction_COUNT, Field: "*" },
+		{ Function: AggregateFunction_AVG, Field: "age" },
+	}, query.Metrics)
+	assert.Equal(t, []Constraint{{ Property: "age", Comparison: Comparison_NOTNULL }}, query.Constraints)
+
+	for _, metric := range []string{ "count", "avg()", "avg(age", "max(*)", "stddev(age)" } {
+		_, err := parse_metric(metric)
+		assert.Error(t, err, metric)
+	}
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// An API key. Only the hash of the key is stored, see `HashApiKey`.
+type ApiKey struct {
+	// Identifier of the key, the id of the principal it authenticates.
+	ID string `json:"id"`
+	// Hex encoded SHA-256 hash of the key.
+	Hash string `json:"hash"`
+	// The scopes of the principal, see `Principal.Allows`. A key without
+	// scopes, e.g. a missing field or a null column, is allowed no route:
+	// unrestricted keys have the scope "*".
+	Scopes []string `json:"scopes"`
+	Roles []string `json:"roles"`
+}
+
+// Hash an API key for storage. API keys are random, so a plain SHA-256
+// hash cannot be reversed by guessing keys.
+func HashApiKey (key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Looks up an API key by its hash. Returns nil and no error for an unknown key.
+type ApiKeyStore func(hash string) (*ApiKey, error)
+
+// Index `keys` by hash, checking that every key has an id and a valid hash.
+func index_api_keys (keys []*ApiKey) (map[string]*ApiKey, error) {
+	by_hash := map[string]*ApiKey{}
+	for i, key := range keys {
+		if len(key.ID) == 0 { return nil, fmt.Errorf("api key %d has no id", i) }
+		hash := strings.ToLower(key.Hash)
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("api key \"%s\" must have a hex encoded sha-256 hash", key.ID)
+		}
+		if _, exists := by_hash[hash]; exists { return nil, fmt.Errorf("api key \"%s\" has the hash of another key", key.ID) }
+		by_hash[hash] = key
+	}
+	return by_hash, nil
+}
+
+// Store the given keys in memory.
+func StaticApiKeyStore (keys []*ApiKey) (ApiKeyStore, error) {
+	by_hash, err := index_api_keys(keys)
+	if err != nil { return nil, err }
+	return func (hash string) (*ApiKey, error) {
+		return by_hash[hash], nil
+	}, nil
+}
+
+// Store the keys of a json file holding a list of keys, e.g.
+// [{ "id": "ci", "hash": "9f86d08...", "scopes": ["users:read"] }].
+// The file is read once.
+func FileApiKeyStore (file_path string) (ApiKeyStore, error) {
+	content, err := os.ReadFile(file_path)
+	if err != nil { return nil, err }
+	var keys []*ApiKey
+	if err := json.Unmarshal(content, &keys); err != nil { return nil, fmt.Errorf("invalid api key file \"%s\": %w", file_path, err) }
+	return StaticApiKeyStore(keys)
+}
+
+// Read a list stored as a json list or a comma separated string, nil if
+// `value` is neither.
+func parse_list_value (value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		list := filter_string_array(strings.Split(v, ","), func (el string) bool { return len(strings.TrimSpace(el)) > 0 })
+		for i, el := range list {
+			list[i] = strings.TrimSpace(el)
+		}
+		return list
+	case []interface{}:
+		list := []string{}
+		for _, el := range v {
+			list = append(list, fmt.Sprint(el))
+		}
+		return list
+	}
+	return nil
+}
+
+// Store the keys in the entries of `provider`, with the fields "id", "hash",
+// "scopes" and "roles". The scopes and roles are json lists or comma
+// separated strings.
+func ProviderApiKeyStore (provider *DataProvider) ApiKeyStore {
+	return func (hash string) (*ApiKey, error) {
+		entry, err := provider.FindOne([]Constraint{{ Property: "hash", Value: hash, Comparison: Comparison_EQ }})
+		if KindOf(err) == ErrorKind_NOT_FOUND { return nil, nil }
+		if err != nil { return nil, err }
+
+		return &ApiKey{
+			ID: fmt.Sprint((*entry)["id"]),
+			Hash: hash,
+			Scopes: parse_list_value((*entry)["scopes"]),
+			Roles: parse_list_value((*entry)["roles"]),
+		}, nil
+	}
+}
+
+type ApiKeyConfig struct {
+	Store ApiKeyStore
+	// The header holding the key.
+	// Default: "X-Api-Key"
+	Header string
+	// The url parameter holding the key, if any. Keys in urls end up in
+	// logs, prefer the header.
+	Param string
+}
+
+// Authenticate requests holding an API key of the store.
+func ApiKeyAuthenticator (config *ApiKeyConfig) (Authenticator, error) {
+	if config == nil || config.Store == nil { return nil, fmt.Errorf("api key authentication requires a key store") }
+	header := config.Header
+	if len(header) == 0 { header = "X-Api-Key" }
+	param := config.Param
+
+	return func (request *Request) (*Principal, error) {
+		key := request.Headers.Get(header)
+		if len(param) > 0 {
+			if len(key) == 0 { key = request.Params.params.Get(param) }
+			// The key is not a constraint.
+			request.Params.params.Del(param)
+		}
+		if len(key) == 0 || request.Principal != nil { return nil, nil }
+
+		found, err := config.Store(HashApiKey(key))
+		if err != nil { return nil, err }
+		if found == nil { return nil, UnauthorizedErrorf("invalid_api_key", "invalid api key") }
+		scopes := found.Scopes
+		if scopes == nil { scopes = []string{} }
+		return &Principal{ ID: found.ID, Scopes: scopes, Roles: found.Roles }, nil
+	}, nil
+}
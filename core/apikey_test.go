@@ -0,0 +1,133 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiKeyAuthentication (t *testing.T) {
+	store, err := StaticApiKeyStore([]*ApiKey{
+		{ ID: "admin", Hash: HashApiKey("admin-key"), Scopes: []string{ "*" } },
+		{ ID: "unscoped", Hash: HashApiKey("unscoped-key") },
+		{ ID: "reader", Hash: HashApiKey("reader-key"), Scopes: []string{ "read" } },
+		{ ID: "orders", Hash: HashApiKey("orders-key"), Scopes: []string{ "orders:*", "users:findone" } },
+	})
+	assert.NoError(t, err)
+	authenticator, err := ApiKeyAuthenticator(&ApiKeyConfig{ Store: store, Param: "api_key" })
+	assert.NoError(t, err)
+
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{
+			{ Name: "Users", Provider: CreateMemoryDataProvider([]map[string]interface{}{{ "id": 1 }}) },
+			{ Name: "Orders", Provider: CreateMemoryDataProvider([]map[string]interface{}{{ "id": 10 }}) },
+		},
+		Authenticators: []Authenticator{ authenticator },
+	})
+	assert.NoError(t, err)
+
+	run := func (route string, key string, params string) (*Request, error) {
+		req := httptest.NewRequest(http.MethodGet, route + "?" + params, nil)
+		if len(key) > 0 { req.Header.Set("X-Api-Key", key) }
+		r := GetRoute(res, route)
+		request, err := r.ReadRequest(req, nil)
+		if err != nil { return nil, err }
+		_, err = r.Handle(request)
+		return request, err
+	}
+
+	request, err := run("/api/users/all", "admin-key", "")
+	assert.NoError(t, err)
+	assert.Equal(t, &Principal{ ID: "admin", Scopes: []string{ "*" } }, request.Principal)
+	// Keys without scopes are allowed no route.
+	_, err = run("/api/users/all", "unscoped-key", "")
+	assert.Equal(t, "insufficient_scope", NewProblem(err).Code)
+
+	_, err = run("/api/users/all", "", "")
+	assert.Equal(t, ErrorKind_UNAUTHORIZED, KindOf(err))
+	assert.Equal(t, "missing_credentials", NewProblem(err).Code)
+	_, err = run("/api/users/all", "wrong-key", "")
+	assert.Equal(t, "invalid_api_key", NewProblem(err).Code)
+
+	// The url parameter holding the key is not a constraint.
+	request, err = run("/api/users/findone", "", "api_key=reader-key&id=-eq%201")
+	assert.NoError(t, err)
+	assert.Equal(t, "reader", request.Principal.ID)
+
+	_, err = run("/api/orders/all", "orders-key", "")
+	assert.NoError(t, err)
+	_, err = run("/api/users/findone", "orders-key", "id=-eq%201")
+	assert.NoError(t, err)
+	_, err = run("/api/users/all", "orders-key", "")
+	assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+	assert.Equal(t, http.StatusForbidden, NewProblem(err).Status)
+
+	t.Run("after another authenticator", func (t *testing.T) {
+		res, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{ Name: "Users", Provider: CreateMemoryDataProvider([]map[string]interface{}{{ "id": 1 }}) }},
+			Authenticators: []Authenticator{
+				func (request *Request) (*Principal, error) { return &Principal{ ID: "session" }, nil },
+				authenticator,
+			},
+		})
+		assert.NoError(t, err)
+		parsed, err := parse_route_params("api_key=reader-key&id=-eq%201")
+		assert.NoError(t, err)
+		request := &Request{ Params: parsed }
+		_, err = GetRoute(res, "/api/users/findone").Handle(request)
+		assert.NoError(t, err)
+		assert.Equal(t, "session", request.Principal.ID)
+	});
+
+	_, err = GetRoute(res, "/api/users/bulk").Handle(&Request{
+		Headers: http.Header{ "X-Api-Key": { "reader-key" } },
+		Body: []byte(`[{"id": 2}]`),
+	})
+	assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+}
+
+func TestApiKeyStores (t *testing.T) {
+	t.Run("file", func (t *testing.T) {
+		file_path := filepath.Join(t.TempDir(), "keys.json")
+		assert.NoError(t, os.WriteFile(file_path, []byte(`[
+			{ "id": "ci", "hash": "` + HashApiKey("ci-key") + `", "scopes": ["users:read"] }
+		]`), 0600))
+		store, err := FileApiKeyStore(file_path)
+		assert.NoError(t, err)
+		key, err := store(HashApiKey("ci-key"))
+		assert.NoError(t, err)
+		assert.Equal(t, &ApiKey{ ID: "ci", Hash: HashApiKey("ci-key"), Scopes: []string{ "users:read" } }, key)
+		key, err = store(HashApiKey("other-key"))
+		assert.NoError(t, err)
+		assert.Nil(t, key)
+	});
+
+	t.Run("provider", func (t *testing.T) {
+		store := ProviderApiKeyStore(CreateMemoryDataProvider([]map[string]interface{}{
+			{ "id": 1, "hash": HashApiKey("key-1"), "scopes": "users:read, orders:read" },
+			{ "id": 2, "hash": HashApiKey("key-2"), "scopes": nil },
+		}))
+		key, err := store(HashApiKey("key-1"))
+		assert.NoError(t, err)
+		assert.Equal(t, &ApiKey{ ID: "1", Hash: HashApiKey("key-1"), Scopes: []string{ "users:read", "orders:read" } }, key)
+		key, err = store(HashApiKey("key-2"))
+		assert.NoError(t, err)
+		assert.Nil(t, key.Scopes)
+		key, err = store(HashApiKey("key-3"))
+		assert.NoError(t, err)
+		assert.Nil(t, key)
+	});
+
+	t.Run("invalid keys", func (t *testing.T) {
+		_, err := StaticApiKeyStore([]*ApiKey{{ ID: "plain", Hash: "secret" }})
+		assert.ErrorContains(t, err, "sha-256")
+		_, err = StaticApiKeyStore([]*ApiKey{{ ID: "a", Hash: HashApiKey("k") }, { ID: "b", Hash: HashApiKey("k") }})
+		assert.ErrorContains(t, err, "hash of another key")
+		_, err = ApiKeyAuthenticator(&ApiKeyConfig{})
+		assert.Error(t, err)
+	});
+}
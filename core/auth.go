@@ -0,0 +1,73 @@
+package core
+
+import (
+	"strings"
+)
+
+// The authenticated client of a request.
+type Principal struct {
+	// Identifier of the client, e.g. the id of its API key.
+	ID string
+	// The routes the client may run, see `Allows`. Unrestricted if nil.
+	Scopes []string
+	// The roles of the client, checked against the policies of the schemas.
+	Roles []string
+	// The claims of the token authenticating the client, if any, with
+	// numbers as `json.Number`.
+	Claims map[string]interface{}
+}
+
+// Authenticates the client of a request from its credentials. Returns nil
+// and no error when the request holds no credentials the authenticator
+// handles, and an error when it holds invalid ones.
+// Once an authenticator recognized the client, the next ones are still
+// called, with `request.Principal` set, to remove their credentials from the
+// request, e.g. a url parameter. Their result is ignored.
+type Authenticator func(request *Request) (*Principal, error)
+
+// Whether the scopes of the principal allow running `route`. A scope is
+// "[schema:]action", where the schema defaults to "*" (every schema) and the
+// action is "*", "read" (GET routes), "write" (POST routes) or the name of a
+// request definition, e.g. "users:read", "orders:bulk" or "read".
+func (p *Principal) Allows (route *RouteResult) bool {
+	return p.allows(route.Schema(), route.Definition(), route.Type)
+}
+
+// Whether the scopes of the principal allow running `definition`, sent with
+// `method`, on the entries of `s`.
+func (p *Principal) allows (s *Schema, definition string, method RequestType) bool {
+	if p.Scopes == nil { return true }
+	access := "read"
+	if method == RequestType_POST { access = "write" }
+	for _, scope := range p.Scopes {
+		schema, action, found := strings.Cut(scope, ":")
+		if !found { schema, action = "*", scope }
+		if schema != "*" && !strings.EqualFold(schema, s.Name) { continue }
+		if action == "*" || action == access || action == definition { return true }
+	}
+	return false
+}
+
+// Set the principal of the request with the first authenticator recognizing
+// its credentials, and reject the request if none does or if the principal
+// is not allowed to run the route.
+func authentication_middleware (authenticators []Authenticator) Middleware {
+	return func (route *RouteResult, request *Request, next Handler) (interface{}, error) {
+		for _, authenticate := range authenticators {
+			if request.Principal != nil {
+				authenticate(request)
+				continue
+			}
+			principal, err := authenticate(request)
+			if err != nil { return nil, err }
+			request.Principal = principal
+		}
+		if request.Principal == nil {
+			return nil, UnauthorizedErrorf("missing_credentials", "the request holds no credentials")
+		}
+		if !request.Principal.Allows(route) {
+			return nil, ForbiddenErrorf("insufficient_scope", "the client is not allowed to run \"%s\"", route.Route)
+		}
+		return next(request)
+	}
+}
@@ -0,0 +1,315 @@
+package core
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	// Maximum number of cached results. The least recently used result is
+	// evicted once the limit is reached.
+	// Default: 1000
+	MaxEntries int
+	// How long a cached result stays valid. Zero means results only leave
+	// the cache through eviction or invalidation.
+	TTL time.Duration
+}
+
+type CacheStats struct {
+	Hits uint64
+	Misses uint64
+	// Number of calls that waited on an identical in-flight query instead of
+	// reaching the backend.
+	Shared uint64
+	Evictions uint64
+	Invalidations uint64
+	// Number of results currently cached.
+	Entries int
+}
+
+type cache_entry struct {
+	key string
+	value interface{}
+	expires time.Time
+}
+
+type cache_call struct {
+	done chan struct{}
+	value interface{}
+	err error
+}
+
+// An LRU/TTL cache sitting in front of a `DataProvider`.
+type Cache struct {
+	config CacheConfig
+	mutex sync.Mutex
+	entries map[string]*list.Element
+	order *list.List
+	inflight map[string]*cache_call
+	// Bumped on every invalidation so that results of queries started before
+	// a write are not stored afterwards.
+	generation uint64
+	stats CacheStats
+	now func() time.Time
+}
+
+func new_cache (config *CacheConfig) *Cache {
+	c := &Cache{
+		entries: map[string]*list.Element{},
+		order: list.New(),
+		inflight: map[string]*cache_call{},
+		now: time.Now,
+	}
+	if config != nil { c.config = *config }
+	if c.config.MaxEntries <= 0 { c.config.MaxEntries = 1000 }
+	return c
+}
+
+// Return a snapshot of the cache counters.
+func (c *Cache) Stats () CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// Drop every cached result.
+func (c *Cache) Invalidate () {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+	c.generation++
+	c.stats.Invalidations++
+}
+
+func (c *Cache) lookup (key string) (interface{}, bool) {
+	el, ok := c.entries[key]
+	if !ok { return nil, false }
+	entry := el.Value.(*cache_entry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (c *Cache) store (key string, value interface{}) {
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+	entry := &cache_entry{ key: key, value: value }
+	if c.config.TTL > 0 { entry.expires = c.now().Add(c.config.TTL) }
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.config.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cache_entry).key)
+		c.stats.Evictions++
+	}
+}
+
+// Return the cached value for `key`, or run `fetch` to compute it. Concurrent
+// callers with the same `key` share a single call to `fetch`.
+func (c *Cache) get (key string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mutex.Lock()
+	if value, ok := c.lookup(key); ok {
+		c.stats.Hits++
+		c.mutex.Unlock()
+		return value, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.stats.Shared++
+		c.mutex.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	c.stats.Misses++
+	call := &cache_call{ done: make(chan struct{}) }
+	c.inflight[key] = call
+	generation := c.generation
+	c.mutex.Unlock()
+
+	call.value, call.err = fetch()
+
+	c.mutex.Lock()
+	delete(c.inflight, key)
+	if call.err == nil && generation == c.generation {
+		c.store(key, call.value)
+	}
+	c.mutex.Unlock()
+	close(call.done)
+
+	return call.value, call.err
+}
+
+// Build a cache key that does not depend on the order of the constraints.
+func normalize_constraints (constraints []Constraint) string {
+	sorted := make([]Constraint, len(constraints))
+	copy(sorted, constraints)
+	sort.Slice(sorted, func (i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Property != b.Property { return a.Property < b.Property }
+		if a.Comparison != b.Comparison { return a.Comparison < b.Comparison }
+		return a.Value < b.Value
+	})
+	encoded, _ := json.Marshal(sorted)
+	return string(encoded)
+}
+
+func copy_entry (entry map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		c[k] = v
+	}
+	return c
+}
+
+// Copy cached rows so that callers mutating a result do not corrupt the cache.
+func copy_entries (entries []map[string]interface{}) []map[string]interface{} {
+	c := make([]map[string]interface{}, len(entries))
+	for i, entry := range entries {
+		c[i] = copy_entry(entry)
+	}
+	return c
+}
+
+// Wrap `provider` with a cache. The returned provider serves repeated reads
+// from the cache and drops every cached result when a write goes through it.
+// The returned `*Cache` exposes statistics and manual invalidation, for
+// writes that reach the backend through other means. If `provider` serves
+// each request with its own provider (`ForRequest`), results are cached by
+// principal, so `ForRequest` must only depend on the principal.
+func CreateCachedDataProvider (provider *DataProvider, config *CacheConfig) (*DataProvider, *Cache) {
+	cache := new_cache(config)
+	cached := cache_data_provider(provider, cache, "")
+	if provider.ForRequest != nil {
+		cached.ForRequest = func (request *Request) *DataProvider {
+			scope, _ := json.Marshal(request.Principal)
+			return cache_data_provider(provider.ForRequest(request), cache, string(scope) + ":")
+		}
+	}
+	return cached, cache
+}
+
+// Wrap `provider` with `cache`, with every key prefixed by `scope`.
+func cache_data_provider (provider *DataProvider, cache *Cache, scope string) *DataProvider {
+	cached := *provider
+	cached.ForRequest = nil
+
+	if provider.All != nil {
+		cached.All = func (offset int, count int) ([]map[string]interface{}, error) {
+			key := scope + fmt.Sprintf("all:%d:%d", offset, count)
+			value, err := cache.get(key, func () (interface{}, error) {
+				entries, err := provider.All(offset, count)
+				if err != nil { return nil, err }
+				return copy_entries(entries), nil
+			})
+			if err != nil { return nil, err }
+			return copy_entries(value.([]map[string]interface{})), nil
+		}
+	}
+
+	if provider.FindOne != nil {
+		cached.FindOne = func (constraints []Constraint) (*map[string]interface{}, error) {
+			key := scope + "findone:" + normalize_constraints(constraints)
+			value, err := cache.get(key, func () (interface{}, error) {
+				entry, err := provider.FindOne(constraints)
+				if err != nil { return nil, err }
+				return copy_entry(*entry), nil
+			})
+			if err != nil { return nil, err }
+			entry := copy_entry(value.(map[string]interface{}))
+			return &entry, nil
+		}
+	}
+
+	if provider.Find != nil {
+		cached.Find = func (constraints []Constraint, offset int, count int) ([]map[string]interface{}, error) {
+			key := scope + fmt.Sprintf("find:%d:%d:%s", offset, count, normalize_constraints(constraints))
+			value, err := cache.get(key, func () (interface{}, error) {
+				entries, err := provider.Find(constraints, offset, count)
+				if err != nil { return nil, err }
+				return copy_entries(entries), nil
+			})
+			if err != nil { return nil, err }
+			return copy_entries(value.([]map[string]interface{})), nil
+		}
+	}
+
+	if provider.Aggregate != nil {
+		cached.Aggregate = func (query *AggregateQuery) ([]map[string]interface{}, error) {
+			metrics := []string{}
+			for _, m := range query.Metrics {
+				metrics = append(metrics, m.Name())
+			}
+			key := scope + fmt.Sprintf("aggregate:%q:%q:%s", query.GroupBy, metrics, normalize_constraints(query.Constraints))
+			value, err := cache.get(key, func () (interface{}, error) {
+				rows, err := provider.Aggregate(query)
+				if err != nil { return nil, err }
+				return copy_entries(rows), nil
+			})
+			if err != nil { return nil, err }
+			return copy_entries(value.([]map[string]interface{})), nil
+		}
+	}
+
+	if provider.Distinct != nil {
+		cached.Distinct = func (field string, constraints []Constraint, limit int) ([]*DistinctValue, error) {
+			key := scope + fmt.Sprintf("distinct:%q:%d:%s", field, limit, normalize_constraints(constraints))
+			value, err := cache.get(key, func () (interface{}, error) {
+				return provider.Distinct(field, constraints, limit)
+			})
+			if err != nil { return nil, err }
+			values := []*DistinctValue{}
+			for _, v := range value.([]*DistinctValue) {
+				copied := *v
+				values = append(values, &copied)
+			}
+			return values, nil
+		}
+	}
+
+	if provider.Search != nil {
+		cached.Search = func (query *SearchQuery) ([]map[string]interface{}, error) {
+			key := scope + fmt.Sprintf("search:%q:%q:%d:%d:%s", query.Text, query.Fields, query.Offset, query.Count, normalize_constraints(query.Constraints))
+			value, err := cache.get(key, func () (interface{}, error) {
+				entries, err := provider.Search(query)
+				if err != nil { return nil, err }
+				return copy_entries(entries), nil
+			})
+			if err != nil { return nil, err }
+			return copy_entries(value.([]map[string]interface{})), nil
+		}
+	}
+
+	if provider.InsertMany != nil {
+		cached.InsertMany = func (entries []map[string]interface{}) (int, error) {
+			defer cache.Invalidate()
+			return provider.InsertMany(entries)
+		}
+	}
+	if provider.Upsert != nil {
+		cached.Upsert = func (entry map[string]interface{}, keys []string) (bool, error) {
+			defer cache.Invalidate()
+			return provider.Upsert(entry, keys)
+		}
+	}
+	if provider.Delete != nil {
+		cached.Delete = func (constraints []Constraint) (int, error) {
+			defer cache.Invalidate()
+			return provider.Delete(constraints)
+		}
+	}
+
+	return &cached
+}
@@ -0,0 +1,225 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type counting_provider struct {
+	all_calls int32
+	findone_calls int32
+	provider *DataProvider
+}
+
+func create_counting_provider (payload []map[string]interface{}, delay time.Duration) *counting_provider {
+	inner := CreateTestableUserProvider(payload)
+	p := &counting_provider{}
+	p.provider = &DataProvider{
+		All: func (offset int, count int) ([]map[string]interface{}, error) {
+			atomic.AddInt32(&p.all_calls, 1)
+			time.Sleep(delay)
+			return inner.All(offset, count)
+		},
+		FindOne: func (constraints []Constraint) (*map[string]interface{}, error) {
+			atomic.AddInt32(&p.findone_calls, 1)
+			return inner.FindOne(constraints)
+		},
+	}
+	return p
+}
+
+func TestDataProviderCachedProvider (t *testing.T) {
+	SetupDataProviderTests(
+		t,
+		func (t *testing.T, ctx *interface{}) error { return nil },
+		func (t *testing.T, ctx *interface{}) error { return nil },
+		func(
+			t *testing.T,
+			schema []*TestSchemaDefinition,
+			payload []map[string]interface{},
+			opaq *interface{})*DataProvider {
+				provider, _ := CreateCachedDataProvider(CreateTestableUserProvider(payload), nil)
+				return provider
+	});
+}
+
+func TestCache (t *testing.T) {
+	t.Run("hits and misses", func (t *testing.T) {
+		payload, _ := GenerateTestUserPayload(10)
+		counting := create_counting_provider(payload, 0)
+		provider, cache := CreateCachedDataProvider(counting.provider, nil)
+
+		for i := 0; i < 3; i++ {
+			entries, err := provider.All(2, 4)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 4)
+		}
+		_, err := provider.All(0, 4)
+		assert.NoError(t, err)
+
+		assert.Equal(t, int32(2), counting.all_calls)
+		stats := cache.Stats()
+		assert.Equal(t, uint64(2), stats.Hits)
+		assert.Equal(t, uint64(2), stats.Misses)
+		assert.Equal(t, 2, stats.Entries)
+	});
+
+	t.Run("constraint order does not matter", func (t *testing.T) {
+		payload := []map[string]interface{}{
+			{ "name": "John", "location": "Arizona" },
+		}
+		counting := create_counting_provider(payload, 0)
+		provider, _ := CreateCachedDataProvider(counting.provider, nil)
+
+		name := Constraint{ Property: "name", Value: "John", Comparison: Comparison_EQ }
+		location := Constraint{ Property: "location", Value: "Arizona", Comparison: Comparison_EQ }
+
+		_, err := provider.FindOne([]Constraint{ name, location })
+		assert.NoError(t, err)
+		_, err = provider.FindOne([]Constraint{ location, name })
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), counting.findone_calls)
+	});
+
+	t.Run("errors are not cached", func (t *testing.T) {
+		counting := create_counting_provider([]map[string]interface{}{}, 0)
+		provider, cache := CreateCachedDataProvider(counting.provider, nil)
+
+		missing := []Constraint{{ Property: "name", Value: "Nobody", Comparison: Comparison_EQ }}
+		_, err := provider.FindOne(missing)
+		assert.Error(t, err)
+		_, err = provider.FindOne(missing)
+		assert.Error(t, err)
+		assert.Equal(t, int32(2), counting.findone_calls)
+		assert.Equal(t, 0, cache.Stats().Entries)
+	});
+
+	t.Run("results are copies", func (t *testing.T) {
+		payload := []map[string]interface{}{
+			{ "name": "John", "location": "Arizona" },
+		}
+		provider, _ := CreateCachedDataProvider(CreateTestableUserProvider(payload), nil)
+
+		entries, err := provider.All(0, 1)
+		assert.NoError(t, err)
+		entries[0]["name"] = "Changed"
+
+		entries, err = provider.All(0, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "John", entries[0]["name"])
+		assert.Equal(t, "John", payload[0]["name"])
+	});
+
+	t.Run("size limit evicts least recently used", func (t *testing.T) {
+		payload, _ := GenerateTestUserPayload(10)
+		counting := create_counting_provider(payload, 0)
+		provider, cache := CreateCachedDataProvider(counting.provider, &CacheConfig{ MaxEntries: 2 })
+
+		provider.All(0, 1)
+		provider.All(1, 1)
+		provider.All(0, 1) // refresh (0, 1)
+		provider.All(2, 1) // evicts (1, 1)
+		provider.All(0, 1)
+		assert.Equal(t, int32(3), counting.all_calls)
+		provider.All(1, 1)
+		assert.Equal(t, int32(4), counting.all_calls)
+		assert.Equal(t, uint64(2), cache.Stats().Evictions)
+	});
+
+	t.Run("ttl expiry", func (t *testing.T) {
+		payload, _ := GenerateTestUserPayload(10)
+		counting := create_counting_provider(payload, 0)
+		provider, cache := CreateCachedDataProvider(counting.provider, &CacheConfig{ TTL: time.Minute })
+
+		now := time.Now()
+		cache.now = func () time.Time { return now }
+		provider.All(0, 1)
+		provider.All(0, 1)
+		assert.Equal(t, int32(1), counting.all_calls)
+
+		now = now.Add(2 * time.Minute)
+		provider.All(0, 1)
+		assert.Equal(t, int32(2), counting.all_calls)
+	});
+
+	t.Run("invalidation", func (t *testing.T) {
+		payload, _ := GenerateTestUserPayload(10)
+		counting := create_counting_provider(payload, 0)
+		provider, cache := CreateCachedDataProvider(counting.provider, nil)
+
+		provider.All(0, 1)
+		cache.Invalidate()
+		provider.All(0, 1)
+		assert.Equal(t, int32(2), counting.all_calls)
+		assert.Equal(t, uint64(1), cache.Stats().Invalidations)
+	});
+
+	t.Run("concurrent identical queries are de-duplicated", func (t *testing.T) {
+		payload, _ := GenerateTestUserPayload(10)
+		counting := create_counting_provider(payload, 50 * time.Millisecond)
+		provider, cache := CreateCachedDataProvider(counting.provider, nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func () {
+				defer wg.Done()
+				entries, err := provider.All(0, 5)
+				assert.NoError(t, err)
+				assert.Len(t, entries, 5)
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), counting.all_calls)
+		stats := cache.Stats()
+		assert.Equal(t, uint64(8), stats.Hits + stats.Misses + stats.Shared)
+	});
+
+	t.Run("writes invalidate the cache", func (t *testing.T) {
+		payload, _ := GenerateTestUserPayload(2)
+		counting := create_counting_provider(payload, 0)
+		memory := CreateMemoryDataProvider(payload)
+		counting.provider.InsertMany = memory.InsertMany
+		counting.provider.Upsert = memory.Upsert
+		provider, cache := CreateCachedDataProvider(counting.provider, nil)
+
+		provider.All(0, 10)
+		_, err := provider.InsertMany([]map[string]interface{}{{ "name": "Alex", "location": "Texas" }})
+		assert.NoError(t, err)
+		provider.All(0, 10)
+		assert.Equal(t, int32(2), counting.all_calls)
+		assert.Equal(t, uint64(1), cache.Stats().Invalidations)
+
+		_, err = provider.Upsert(map[string]interface{}{ "name": "Alex", "location": "Ohio" }, []string{ "name" })
+		assert.NoError(t, err)
+		provider.All(0, 10)
+		assert.Equal(t, int32(3), counting.all_calls)
+		assert.Equal(t, uint64(2), cache.Stats().Invalidations)
+	});
+
+	t.Run("results are cached by principal", func (t *testing.T) {
+		tenants := map[string]*DataProvider{
+			"acme": CreateMemoryDataProvider([]map[string]interface{}{{ "id": 1, "tenant": "acme" }}),
+			"globex": CreateMemoryDataProvider([]map[string]interface{}{{ "id": 2, "tenant": "globex" }}),
+		}
+		scoped := *tenants["acme"]
+		scoped.ForRequest = func (request *Request) *DataProvider { return tenants[request.Principal.ID] }
+		provider, cache := CreateCachedDataProvider(&scoped, nil)
+
+		all := func (tenant string) []map[string]interface{} {
+			entries, err := provider.ForRequest(&Request{ Principal: &Principal{ ID: tenant } }).All(0, 10)
+			assert.NoError(t, err)
+			return entries
+		}
+		assert.Equal(t, "acme", all("acme")[0]["tenant"])
+		assert.Equal(t, "globex", all("globex")[0]["tenant"])
+		assert.Equal(t, "globex", all("globex")[0]["tenant"])
+		assert.Equal(t, uint64(1), cache.Stats().Hits)
+		assert.Equal(t, 2, cache.Stats().Entries)
+	});
+}
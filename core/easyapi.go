@@ -1,10 +1,14 @@
 package core
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"math"
+	"net/http"
 	"net/url"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -15,12 +19,125 @@ type DataProvider struct {
 	// into the data payload and `count` entries are returned.
 	All func(offset int, count int) ([]map[string]interface{}, error)
 	FindOne func(constraints []Constraint) (*map[string]interface{}, error)
+	// Return the entries matching every constraint, from `offset` and at
+	// most `count` of them.
+	// Optional, required to include the schema's entries through a relation.
+	Find func(constraints []Constraint, offset int, count int) ([]map[string]interface{}, error)
+	// Insert all the `entries` at once and return the number of inserted
+	// entries. Either every entry is inserted or none is, in which case the
+	// failing entries are reported with a `*BulkInsertError`.
+	// Optional, the "bulk" route is only served when set.
+	InsertMany func(entries []map[string]interface{}) (int, error)
+	// Insert `entry`, or update the existing entry holding the same values
+	// for the `keys` fields, and no other entry: the row filters only check
+	// that one. Returns true when a new entry was created.
+	// Optional, the "upsert" route is only served when set.
+	Upsert func(entry map[string]interface{}, keys []string) (bool, error)
+	// Compute the metrics of `query` for each group of matching entries.
+	// Each row holds the group by fields and a key per metric, named after
+	// `Metric.Name()`. Optional, the "aggregate" route is only served when set.
+	Aggregate func(query *AggregateQuery) ([]map[string]interface{}, error)
+	// Return the distinct values of `field` among the entries matching the
+	// `constraints`, with their number of occurrences, most frequent first.
+	// At most `limit` values are returned.
+	// Optional, the "distinct" route is only served when set.
+	Distinct func(field string, constraints []Constraint, limit int) ([]*DistinctValue, error)
+	// Return the entries whose searched fields match the text of `query`,
+	// most relevant first.
+	// Optional, the "search" route is only served when set.
+	Search func(query *SearchQuery) ([]map[string]interface{}, error)
+	// Delete the entries matching every constraint and return their number.
+	// Optional, the "delete" route is only served when set and enabled by
+	// `Schema.Deletable`.
+	Delete func(constraints []Constraint) (int, error)
+	// Return the provider serving `request`, e.g. one reading the claims of
+	// `request.Principal`. The routes served are those of this provider.
+	// Optional, this provider serves every request otherwise.
+	ForRequest func(request *Request) *DataProvider
 }
 
+// The provider serving `request` for the schema.
+func (s *Schema) provider (request *Request) *DataProvider {
+	if s.Provider.ForRequest == nil { return s.Provider }
+	return s.Provider.ForRequest(request)
+}
+
+// The error of a single entry of a bulk operation.
+type RowError struct {
+	// Position of the entry in the request.
+	Index int `json:"index"`
+	Message string `json:"message"`
+	// The fields of the entry at fault, if any.
+	Fields []*FieldError `json:"fields,omitempty"`
+}
+
+// Returned when some entries of a bulk insert are rejected. No entry is
+// inserted in that case.
+type BulkInsertError struct {
+	Errors []*RowError
+}
+
+func (e *BulkInsertError) Error() string {
+	messages := []string{}
+	for _, row := range e.Errors {
+		messages = append(messages, fmt.Sprintf("entry %d: %s", row.Index, row.Message))
+	}
+	return fmt.Sprintf("%d entries rejected: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+type BulkResult struct {
+	Inserted int `json:"inserted"`
+}
+
+type UpsertResult struct {
+	// Whether a new entry was created rather than an existing one updated.
+	Created bool `json:"created"`
+}
+
+type DeleteResult struct {
+	Deleted int `json:"deleted"`
+}
+
+type DistinctValue struct {
+	Value interface{} `json:"value"`
+	Count int `json:"count"`
+}
+
+// Default maximum number of distinct values served by the "distinct" route.
+const DefaultMaxDistinctValues = 100
+
 type Schema struct {
 	Name string
 	// The data provider associated with this schema.
 	Provider *DataProvider
+	// The fields served by this schema. Optional, but required by the
+	// features that depend on field types or primary keys.
+	Fields []*Field
+	// The "distinct" route fails for fields holding more distinct values,
+	// rather than serving a truncated list.
+	// Default: DefaultMaxDistinctValues
+	MaxDistinctValues int
+	// The relations to other schemas, which "all" and "findone" embed in
+	// their results when named by the "include" url parameter.
+	Relations []*Relation
+	// Middlewares of the routes serving the schema's entries, after the
+	// middlewares of the config.
+	Middlewares []Middleware
+	// Middlewares of single routes, by request definition name (e.g. "all"),
+	// after the middlewares of the schema.
+	RouteMiddlewares map[string][]Middleware
+	// Business logic run by the routes around the calls to the provider.
+	Hooks *SchemaHooks
+	// The roles allowed to run each route, checked after authentication.
+	// If nil, any client may run the routes. Requires `Config.Authenticators`.
+	Policy Policy
+	// Restrict the entries read and written by each client, see `RowFilter`.
+	// Requires `Config.Authenticators`.
+	RowFilters []*RowFilter
+	// Whether the "delete" route is served, for providers supporting Delete.
+	// Deleting entries cannot be undone, so the route must be enabled.
+	// Default: false
+	Deletable bool
 }
 
 type Config struct {
@@ -29,8 +146,20 @@ type Config struct {
 	// The root of the api. If set, it will be prepended to the api route.
 	// Default: "api"
 	Root string
+	// Maximum size in bytes of a request body.
+	// Default: DefaultMaxBodySize
+	MaxBodySize int64
+	// Middlewares of every route, outermost first.
+	Middlewares []Middleware
+	// Authenticate the requests of every route, after the middlewares of the
+	// config and before those of the schemas. The first authenticator
+	// recognizing the credentials of a request sets its principal. If set,
+	// requests without valid credentials are rejected.
+	Authenticators []Authenticator
 }
 
+const DefaultMaxBodySize = 1 << 20
+
 type RequestType int
 const (
 	RequestType_UNDEF RequestType = 0
@@ -38,10 +167,35 @@ const (
 	RequestType_POST RequestType = 2
 )
 
+// A request received by a route.
+type Request struct {
+	Params *UrlParams
+	// The values of the placeholders of the route, e.g. { "id": "7" } for
+	// "/api/users/{id}/orders/all".
+	PathParams map[string]string
+	// The headers of the http request, if any.
+	Headers http.Header
+	// The raw request body, if any.
+	Body []byte
+	// The body decoded as json, with numbers kept as `json.Number`. Nil
+	// without a body.
+	Data interface{}
+	// Constraints implied by the route rather than the url parameters, e.g.
+	// "user_id -eq 7" for "/api/users/7/orders/all". Always applied.
+	Constraints []Constraint
+	// The authenticated client, nil without authentication.
+	Principal *Principal
+}
+
 type RequestDefinition struct {
 	name string
 	method RequestType
-	action func(route_params *UrlParams, provider *DataProvider) (interface{}, error)
+	action func(request *Request, schema *Schema) (interface{}, error)
+	// Whether the schema serves the definition. If nil, every schema does.
+	available func(schema *Schema) bool
+	// Whether the provider also supports the definition under a nested
+	// route. If nil, every provider supporting the definition does.
+	available_nested func(provider *DataProvider) bool
 }
 
 type RouteResult struct {
@@ -49,15 +203,80 @@ type RouteResult struct {
 	Route string
 	// The type that the route should be registered as.
 	Type RequestType
+	// The names of the placeholders of `Route`, e.g. ["id"] for
+	// "/api/users/{id}/orders/all".
+	PathParams []string
 
 	_definition RequestDefinition
 	_schema *Schema
+	// The relation a nested route goes through.
+	_relation *Relation
+	_max_body_size int64
+	_middlewares []Middleware
+	_authenticated bool
 }
 
 func (r *RouteResult) Action (route_params string) (interface{}, error) {
+	return r.ActionWithBody(route_params, nil)
+}
+
+// Run the route with the given url parameters and request `body`.
+func (r *RouteResult) ActionWithBody (route_params string, body []byte) (interface{}, error) {
+	return r.ActionWithPath(nil, route_params, body)
+}
+
+// Run the route with the values of its placeholders, url parameters and
+// request `body`.
+func (r *RouteResult) ActionWithPath (path_params map[string]string, route_params string, body []byte) (interface{}, error) {
 	parsed_params, err := parse_route_params(route_params)
 	if err != nil { return nil, err }
-	return r._definition.action(parsed_params, r._schema.Provider)
+	return r.Handle(&Request{ Params: parsed_params, PathParams: path_params, Body: body })
+}
+
+// Run the route with `request`, e.g. built with `ReadRequest`, through its
+// middlewares. The body is decoded unless `request.Data` is already set.
+func (r *RouteResult) Handle (request *Request) (interface{}, error) {
+	if request.Params == nil { request.Params = CreateUrlParams(url.Values{}) }
+	return chain_middlewares(r, r._middlewares, r.run)(request)
+}
+
+// The name of the request definition of the route, e.g. "all".
+func (r *RouteResult) Definition () string {
+	return r._definition.name
+}
+
+// The schema whose entries the route serves. For a nested route, the
+// related schema, e.g. "Orders" for "/api/users/{id}/orders/all".
+func (r *RouteResult) Schema () *Schema {
+	return r._schema
+}
+
+func (r *RouteResult) run (request *Request) (interface{}, error) {
+	if int64(len(request.Body)) > r.max_body_size() {
+		return nil, TooLargeErrorf("body_too_large", "request body exceeds %d bytes", r.max_body_size())
+	}
+	if request.Data == nil && len(bytes.TrimSpace(request.Body)) > 0 {
+		if err := decode_json(request.Body, &request.Data); err != nil {
+			return nil, ValidationErrorf("invalid_body", "request body is not valid json: %w", err)
+		}
+	}
+
+	for _, name := range r.PathParams {
+		if len(request.PathParams[name]) == 0 { return nil, ValidationErrorf("missing_param", "missing value for the path parameter \"%s\"", name).WithField(name, "missing value") }
+	}
+	if r._relation != nil {
+		request.Constraints = append(request.Constraints, Constraint{
+			Property: r._relation.ForeignField,
+			Value: request.PathParams[r._relation.Field],
+			Comparison: Comparison_EQ,
+		})
+	}
+	return r._definition.action(request, r._schema)
+}
+
+func (r *RouteResult) max_body_size () int64 {
+	if r._max_body_size <= 0 { return DefaultMaxBodySize }
+	return r._max_body_size
 }
 
 type UrlParams struct {
@@ -74,7 +293,7 @@ func CreateUrlParams (url_values url.Values) *UrlParams {
 func (u *UrlParams) Get(key string) (string, error) {
 	value := u.params.Get(key)
 	if len(value) == 0 {
-		return "", fmt.Errorf(fmt.Sprintf("no url param entry found for key \"%s\"", key))
+		return "", ValidationErrorf("missing_param", "no url param entry found for key \"%s\"", key).WithField(key, "missing value")
 	}
 	return value, nil
 }
@@ -83,7 +302,7 @@ func (u *UrlParams) GetInt(key string) (int, error) {
 	str_value, err := u.Get(key)
 	if err != nil { return -1, err }
 	int_value, err := strconv.Atoi(str_value)
-	if err != nil { return -1, err }
+	if err != nil { return -1, ValidationErrorf("invalid_param", "url param \"%s\" must be an integer, received \"%s\"", key, str_value).WithField(key, "must be an integer") }
 	return int_value, nil
 }
 
@@ -96,12 +315,26 @@ const (
 	Comparison_LE Comparison = "le"
 	Comparison_GT Comparison = "gt"
 	Comparison_GE Comparison = "ge"
+	// The property is NULL. Takes no value.
+	Comparison_NULL Comparison = "null"
+	// The property is not NULL. Takes no value.
+	Comparison_NOTNULL Comparison = "notnull"
+	// The property equals one of the `Values` of the constraint, written
+	// as a comma separated list, e.g. "-in 1,2,3".
+	Comparison_IN Comparison = "in"
 )
 
+// Whether the comparison is written without a value, e.g. "-null".
+func (c Comparison) IsUnary() bool {
+	return c == Comparison_NULL || c == Comparison_NOTNULL
+}
+
 type Constraint struct {
 	Property string
 	Value string
 	Comparison Comparison
+	// The values of a Comparison_IN constraint.
+	Values []string
 }
 
 func filter_string_array(lst []string, filter_fn func(string) bool) []string {
@@ -115,7 +348,7 @@ func filter_string_array(lst []string, filter_fn func(string) bool) []string {
 }
 
 // Parse a comparison part, e.g. "eq "Sam"" should return
-// (Comparison_EQ, "Sam", nil)
+// (Comparison_EQ, "Sam", nil), and "-null" should return (Comparison_NULL, "", nil)
 func parse_comparison_part (part string) (Comparison, string, error) {
 	part = strings.TrimSpace(part)
 	last := len(part) - 1
@@ -128,8 +361,17 @@ func parse_comparison_part (part string) (Comparison, string, error) {
 	parts := strings.Split(part, " ")
 	parts = filter_string_array(parts, func (el string) bool { return len(el) > 0 })
 
+	if len(parts) == 1 {
+		switch parts[0] {
+		case "-null":
+			return Comparison_NULL, "", nil
+		case "-notnull":
+			return Comparison_NOTNULL, "", nil
+		}
+	}
+
 	if len(parts) != 2 {
-		return Comparison_UNDEF, "", fmt.Errorf(fmt.Sprintf("expected 2 parts in comparison string, received %d. comparison string=\"%#v\"", len(parts), parts))
+		return Comparison_UNDEF, "", ValidationErrorf("invalid_constraint", "expected 2 parts in comparison string, received %d. comparison string=\"%#v\"", len(parts), parts)
 	}
 
 	switch parts[0] {
@@ -145,16 +387,21 @@ func parse_comparison_part (part string) (Comparison, string, error) {
 		return Comparison_GT, parts[1], nil
 	case "-ge":
 		return Comparison_GE, parts[1], nil
+	case "-in":
+		return Comparison_IN, parts[1], nil
 	}
-	return Comparison_UNDEF, "", fmt.Errorf("unknown comparison operator: \"%s\"", parts[0])
+	return Comparison_UNDEF, "", ValidationErrorf("invalid_constraint", "unknown comparison operator: \"%s\"", parts[0])
 }
 
-func parse_constraints(route_params *UrlParams) ([]Constraint, error) {
+// Parse the url parameters into constraints. The `reserved` parameters
+// configure the route and are not constraints.
+func parse_constraints(route_params *UrlParams, reserved ...string) ([]Constraint, error) {
 
 	var constraints []Constraint
 
 	for key, values := range route_params.params {
 		if len(values) != 1 { continue }
+		if slices.Contains(reserved, key) { continue }
 		var value string = values[0]
 		
 		comparison, right_value, err := parse_comparison_part(value)
@@ -164,6 +411,9 @@ func parse_constraints(route_params *UrlParams) ([]Constraint, error) {
 		c.Property = key
 		c.Value = right_value
 		c.Comparison = comparison
+		if comparison == Comparison_IN {
+			c.Values = filter_string_array(strings.Split(right_value, ","), func (el string) bool { return len(el) > 0 })
+		}
 
 		constraints = append(constraints, c)
 	}
@@ -176,7 +426,10 @@ var _requestDefinitions = []RequestDefinition {
 	{
 		name: "all",
 		method: RequestType_GET,
-		action: func (route_params *UrlParams, provider *DataProvider) (interface{}, error) {
+		// Listing the entries of a nested route filters them.
+		available_nested: func (provider *DataProvider) bool { return provider.Find != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			route_params := request.Params
 
 			offset, err := route_params.GetInt("offset")
 			if err !=  nil { offset = 0 }
@@ -184,32 +437,307 @@ var _requestDefinitions = []RequestDefinition {
 			if err != nil { ct = math.MaxInt32 }
 
 			if offset < 0 || ct < 0 {
-				return nil, fmt.Errorf(fmt.Sprintf("negative offset or count not allowed, offset = %d, count = %d", offset, ct))
+				return nil, ValidationErrorf("invalid_param", "negative offset or count not allowed, offset = %d, count = %d", offset, ct)
 			}
 
-			payload, err := provider.All(offset, ct)
+			relations, err := parse_includes(request, schema)
+			if err != nil { return nil, err }
+
+			constraints, err := schema.before_find(request, request.Constraints)
+			if err != nil { return nil, err }
+
+			provider := schema.provider(request)
+			var payload []map[string]interface{}
+			if len(constraints) > 0 {
+				if provider.Find == nil {
+					return nil, new_error(ErrorKind_UNAVAILABLE, "unsupported_find", "the provider of \"%s\" does not support Find, required by the constraints of the hooks", schema.Name)
+				}
+				payload, err = provider.Find(constraints, offset, ct)
+			} else {
+				payload, err = provider.All(offset, ct)
+			}
 			if err != nil {
 				return nil, err
 			}
+			payload, err = schema.filter_rows(request, payload)
+			if err != nil { return nil, err }
+			if err := schema.after_find(request, payload); err != nil { return nil, err }
+			if err := include_relations(request, payload, relations); err != nil { return nil, err }
+			schema.redact_entries(request, payload)
 
 			return &payload, nil
 		},
 	},{
 		name: "findone",
 		method: RequestType_GET,
-		action: func (route_params *UrlParams, provider *DataProvider) (interface{}, error) {
-			constraints, err := parse_constraints(route_params)
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			constraints, err := parse_constraints(request.Params, "include")
+			if err != nil { return nil, err }
+			if err := schema.check_queried_fields(request, constraint_fields(constraints)); err != nil { return nil, err }
+			constraints = append(constraints, request.Constraints...)
+			relations, err := parse_includes(request, schema)
 			if err != nil { return nil, err }
-			return provider.FindOne(constraints)
+			constraints, err = schema.before_find(request, constraints)
+			if err != nil { return nil, err }
+
+			entry, err := schema.provider(request).FindOne(constraints)
+			if err != nil { return nil, err }
+			entries, err := schema.filter_rows(request, []map[string]interface{}{ *entry })
+			if err != nil { return nil, err }
+			if len(entries) == 0 { return nil, NotFoundErrorf("not_found", "no entries found") }
+			if err := schema.after_find(request, entries); err != nil { return nil, err }
+			if err := include_relations(request, entries, relations); err != nil { return nil, err }
+			schema.redact_entries(request, entries)
+			return entry, nil
+		},
+	},{
+		name: "bulk",
+		method: RequestType_POST,
+		available: func (schema *Schema) bool { return schema.Provider.InsertMany != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			entries, err := parse_bulk_body(request.Data)
+			if err != nil { return nil, err }
+			bulk_err := &BulkInsertError{}
+			for i, entry := range entries {
+				if err := schema.check_written_fields(request, entry, nil); err != nil {
+					bulk_err.Errors = append(bulk_err.Errors, &RowError{ Index: i, Message: err.Error(), Fields: err.Fields })
+					continue
+				}
+				if err := apply_route_constraints(entry, request.Constraints, schema); err != nil {
+					bulk_err.Errors = append(bulk_err.Errors, &RowError{ Index: i, Message: err.Error() })
+					continue
+				}
+				if err := schema.before_write(request, entry, true, false); err != nil {
+					// Entries rejected by a hook are reported with the others,
+					// any other failure of a hook aborts the request.
+					if KindOf(err) != ErrorKind_VALIDATION { return nil, err }
+					bulk_err.Errors = append(bulk_err.Errors, &RowError{ Index: i, Message: err.Error() })
+					continue
+				}
+				if err := validate_entry(entry, schema); err != nil {
+					bulk_err.Errors = append(bulk_err.Errors, &RowError{ Index: i, Message: err.Error(), Fields: err.Fields })
+				}
+			}
+			if len(bulk_err.Errors) > 0 { return nil, bulk_err }
+
+			inserted, err := schema.provider(request).InsertMany(entries)
+			if err != nil { return nil, err }
+			for _, entry := range entries {
+				if err := schema.after_write(request, entry, true); err != nil { return nil, err }
+			}
+			return &BulkResult{ Inserted: inserted }, nil
+		},
+	},{
+		name: "upsert",
+		method: RequestType_POST,
+		available: func (schema *Schema) bool { return schema.Provider.Upsert != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			entry, ok := request.Data.(map[string]interface{})
+			if !ok { return nil, ValidationErrorf("invalid_body", "upsert request body must be a json object") }
+			keys, err := parse_conflict_keys(request.Params, schema)
+			if err != nil { return nil, err }
+			// Upserting on a key tells whether an entry holds its value.
+			if err := schema.check_queried_fields(request, keys); err != nil { return nil, err }
+			if err := schema.check_written_fields(request, entry, keys); err != nil { return nil, err }
+			if err := apply_route_constraints(entry, request.Constraints, schema); err != nil { return nil, err }
+			// The entry may be created or update an existing one.
+			if err := schema.before_write(request, entry, true, true); err != nil { return nil, err }
+			if err := validate_entry(entry, schema); err != nil { return nil, err }
+			for _, key := range keys {
+				if entry[key] == nil {
+					return nil, ValidationErrorf("missing_field", "upsert entry must hold a value for the conflict key \"%s\"", key).WithField(key, "missing value")
+				}
+			}
+			if err := schema.check_row_owner(request, entry, keys); err != nil { return nil, err }
+
+			created, err := schema.provider(request).Upsert(entry, keys)
+			if err != nil { return nil, err }
+			if err := schema.after_write(request, entry, created); err != nil { return nil, err }
+			return &UpsertResult{ Created: created }, nil
+		},
+	},{
+		name: "delete",
+		method: RequestType_POST,
+		available: func (schema *Schema) bool { return schema.Deletable && schema.Provider.Delete != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			constraints, err := parse_constraints(request.Params)
+			if err != nil { return nil, err }
+			if err := schema.check_queried_fields(request, constraint_fields(constraints)); err != nil { return nil, err }
+			constraints = append(constraints, request.Constraints...)
+			// Deleting every entry at once is never intended.
+			if len(constraints) == 0 { return nil, ValidationErrorf("missing_constraints", "delete requires at least one constraint") }
+			constraints, err = schema.before_delete(request, constraints)
+			if err != nil { return nil, err }
+
+			deleted, err := schema.provider(request).Delete(constraints)
+			if err != nil { return nil, err }
+			if err := schema.after_delete(request, deleted); err != nil { return nil, err }
+			return &DeleteResult{ Deleted: deleted }, nil
+		},
+	},{
+		name: "aggregate",
+		method: RequestType_GET,
+		available: func (schema *Schema) bool { return schema.Provider.Aggregate != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			query, err := parse_aggregate_query(request.Params)
+			if err != nil { return nil, err }
+			queried := append(constraint_fields(query.Constraints), query.GroupBy...)
+			for _, metric := range query.Metrics {
+				if metric.Field != "*" { queried = append(queried, metric.Field) }
+			}
+			if err := schema.check_queried_fields(request, queried); err != nil { return nil, err }
+			query.Constraints = append(query.Constraints, request.Constraints...)
+			if err := validate_aggregate_query(query, schema); err != nil { return nil, err }
+			query.Constraints, err = schema.before_find(request, query.Constraints)
+			if err != nil { return nil, err }
+
+			rows, err := schema.provider(request).Aggregate(query)
+			if err != nil { return nil, err }
+			return &rows, nil
+		},
+	},{
+		name: "distinct",
+		method: RequestType_GET,
+		available: func (schema *Schema) bool { return schema.Provider.Distinct != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			field, err := request.Params.Get("field")
+			if err != nil { return nil, err }
+			if len(schema.Fields) > 0 {
+				f := schema.Field(field)
+				if f == nil { return nil, ValidationErrorf("unknown_field", "unknown field \"%s\"", field).WithField("field", "unknown field") }
+				if f.Type == FieldType_JSON || f.Type == FieldType_BLOB {
+					return nil, ValidationErrorf("invalid_field_type", "cannot list the distinct values of the json or blob field \"%s\"", field).WithField("field", "json or blob field")
+				}
+			}
+			constraints, err := parse_constraints(request.Params, "field")
+			if err != nil { return nil, err }
+			if err := schema.check_queried_fields(request, append(constraint_fields(constraints), field)); err != nil { return nil, err }
+			constraints = append(constraints, request.Constraints...)
+			constraints, err = schema.before_find(request, constraints)
+			if err != nil { return nil, err }
+
+			max_values := schema.MaxDistinctValues
+			if max_values <= 0 { max_values = DefaultMaxDistinctValues }
+			// Ask for one more value to tell whether the field exceeds the maximum.
+			values, err := schema.provider(request).Distinct(field, constraints, max_values + 1)
+			if err != nil { return nil, err }
+			if len(values) > max_values {
+				return nil, ValidationErrorf("too_many_values", "field \"%s\" holds more than %d distinct values", field, max_values).WithField("field", "too many distinct values")
+			}
+			return &values, nil
+		},
+	},{
+		name: "search",
+		method: RequestType_GET,
+		available: func (schema *Schema) bool { return schema.Provider.Search != nil },
+		action: func (request *Request, schema *Schema) (interface{}, error) {
+			query, err := parse_search_query(request, schema)
+			if err != nil { return nil, err }
+			if err := schema.check_queried_fields(request, constraint_fields(query.Constraints)); err != nil { return nil, err }
+			query.Constraints = append(query.Constraints, request.Constraints...)
+			query.Constraints, err = schema.before_find(request, query.Constraints)
+			if err != nil { return nil, err }
+
+			payload, err := schema.provider(request).Search(query)
+			if err != nil { return nil, err }
+			payload, err = schema.filter_rows(request, payload)
+			if err != nil { return nil, err }
+			if err := schema.after_find(request, payload); err != nil { return nil, err }
+			schema.redact_entries(request, payload)
+			return &payload, nil
 		},
 	},
 }
 
+// Set the fields of a written `entry` to the values required by the
+// constraints of its route. An entry holding another value is rejected.
+func apply_route_constraints (entry map[string]interface{}, constraints []Constraint, schema *Schema) error {
+	for _, c := range constraints {
+		if c.Comparison != Comparison_EQ { continue }
+		if value, exists := entry[c.Property]; exists && value != nil {
+			if compare_values(value, c.Value) != 0 {
+				return ValidationErrorf("invalid_value", "field \"%s\" must be \"%s\" on this route", c.Property, c.Value).WithField(c.Property, "does not match the route")
+			}
+			continue
+		}
+		entry[c.Property] = route_value(c.Value, schema.Field(c.Property))
+	}
+	return nil
+}
+
+// Convert the string value of a route into the json value of `field`, so
+// that e.g. "7" is written as a number to an INT field.
+func route_value (value string, field *Field) interface{} {
+	if field == nil { return value }
+	switch {
+	case field.Type.IsNumeric():
+		if _, err := strconv.ParseFloat(value, 64); err == nil { return json.Number(value) }
+	case field.Type == FieldType_BOOL:
+		if b, err := strconv.ParseBool(value); err == nil { return b }
+	}
+	return value
+}
+
+// Read the fields identifying the entry to update from the comma separated
+// "key" url parameter, defaulting to the primary key of `schema`.
+func parse_conflict_keys (route_params *UrlParams, schema *Schema) ([]string, error) {
+	param, err := route_params.Get("key")
+	if err != nil {
+		keys := schema.PrimaryKey()
+		if len(keys) == 0 {
+			return nil, ValidationErrorf("missing_param", "no conflict key: set the \"key\" url parameter or declare the primary key fields of \"%s\"", schema.Name).WithField("key", "missing value")
+		}
+		return keys, nil
+	}
+
+	keys := filter_string_array(strings.Split(param, ","), func (el string) bool { return len(el) > 0 })
+	if len(keys) == 0 { return nil, ValidationErrorf("invalid_param", "conflict key cannot be empty").WithField("key", "empty") }
+	for i, key := range keys {
+		keys[i] = strings.TrimSpace(key)
+		if len(schema.Fields) > 0 && schema.Field(keys[i]) == nil {
+			return nil, ValidationErrorf("unknown_field", "unknown conflict key field \"%s\"", keys[i]).WithField("key", "unknown field")
+		}
+	}
+	return keys, nil
+}
+
+// Decode a single json value, keeping numbers as `json.Number` so that large
+// integers are not rounded.
+func decode_json (body []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil { return err }
+	if decoder.More() { return fmt.Errorf("unexpected data after the json value") }
+	return nil
+}
+
+// Parse the decoded body of a bulk request, which must be a non-empty json
+// array of objects. Entries that are not objects are reported with a
+// `*BulkInsertError`.
+func parse_bulk_body (body interface{}) ([]map[string]interface{}, error) {
+	list, ok := body.([]interface{})
+	if !ok { return nil, ValidationErrorf("invalid_body", "bulk request body must be a json array") }
+	if len(list) == 0 { return nil, ValidationErrorf("invalid_body", "bulk request body cannot be empty") }
+
+	entries := []map[string]interface{}{}
+	bulk_err := &BulkInsertError{}
+	for i, el := range list {
+		entry, ok := el.(map[string]interface{})
+		if !ok {
+			bulk_err.Errors = append(bulk_err.Errors, &RowError{ Index: i, Message: "entry is not a json object" })
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(bulk_err.Errors) > 0 { return nil, bulk_err }
+	return entries, nil
+}
+
 // Parse url parameters from the given string, `params`.
 // e.g. "key=value&&enable=true" will return { "key": "value", "enable": "true" }
 func parse_route_params (params string) (*UrlParams, error) {
 	query, err := url.ParseQuery(params)
-	if err != nil { return nil, err }
+	if err != nil { return nil, ValidationErrorf("invalid_param", "invalid url parameters: %w", err) }
 	return CreateUrlParams(query), nil
 
 }
@@ -230,20 +758,65 @@ func EasyApiImpl (config *Config) (*Result, error) {
 		root = config.Root
 	}
 
+	if err := resolve_relations(config.Schemas); err != nil { return nil, err }
+	for _, schema := range config.Schemas {
+		if err := compile_field_patterns(schema); err != nil { return nil, err }
+		if err := check_route_middlewares(schema); err != nil { return nil, err }
+		if err := check_policy(schema); err != nil { return nil, err }
+		if err := check_row_filters(schema); err != nil { return nil, err }
+		// Without authenticators no request holds a principal to authorize.
+		if (schema.Policy != nil || len(schema.RowFilters) > 0) && len(config.Authenticators) == 0 {
+			return nil, fmt.Errorf("policy and row filters of schema \"%s\" require at least one authenticator", schema.Name)
+		}
+	}
+
 	for _, schema := range config.Schemas {
 		var schema_name string = strings.ToLower(schema.Name)
 		if len(schema_name) == 0 {
 			return nil, fmt.Errorf("schema name cannot be empty")
 		}
 		for _, definition := range _requestDefinitions {
-			
+			if definition.available != nil && !definition.available(schema) { continue }
+
 			var route_result RouteResult
 			route_result.Route = path.Join(root, schema_name, definition.name)
 			route_result.Type = definition.method
 			route_result._definition = definition
 			route_result._schema = schema
+			route_result._max_body_size = config.MaxBodySize
+			route_result._middlewares = route_middlewares(config, schema, definition.name)
+			route_result._authenticated = len(config.Authenticators) > 0
 			results.Routes = append(results.Routes, &route_result)
 		}
 	}
+
+	// Nested routes, e.g. "/api/users/{id}/orders/all" for the orders of a user.
+	for _, schema := range config.Schemas {
+		for _, relation := range schema.Relations {
+			related := relation._schema
+			for _, definition := range _requestDefinitions {
+				if definition.available != nil && !definition.available(related) { continue }
+				if definition.available_nested != nil && !definition.available_nested(related.Provider) { continue }
+
+				var route_result RouteResult
+				route_result.Route = path.Join(
+					root,
+					strings.ToLower(schema.Name),
+					fmt.Sprintf("{%s}", relation.Field),
+					strings.ToLower(relation.Name),
+					definition.name,
+				)
+				route_result.Type = definition.method
+				route_result.PathParams = []string{ relation.Field }
+				route_result._definition = definition
+				route_result._schema = related
+				route_result._relation = relation
+				route_result._max_body_size = config.MaxBodySize
+				route_result._middlewares = route_middlewares(config, related, definition.name)
+				route_result._authenticated = len(config.Authenticators) > 0
+				results.Routes = append(results.Routes, &route_result)
+			}
+		}
+	}
 	return results, nil
 }
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type ErrorKind string
+const (
+	ErrorKind_UNDEF ErrorKind = ""
+	// The request is malformed or holds invalid values.
+	ErrorKind_VALIDATION ErrorKind = "validation"
+	ErrorKind_NOT_FOUND ErrorKind = "not_found"
+	// The request conflicts with the stored data, e.g. a duplicate key.
+	ErrorKind_CONFLICT ErrorKind = "conflict"
+	// The request lacks valid credentials.
+	ErrorKind_UNAUTHORIZED ErrorKind = "unauthorized"
+	// The client of the request is not allowed to run it.
+	ErrorKind_FORBIDDEN ErrorKind = "forbidden"
+	// The backend of a data provider cannot be reached.
+	ErrorKind_UNAVAILABLE ErrorKind = "unavailable"
+	// The request body exceeds the maximum body size.
+	ErrorKind_TOO_LARGE ErrorKind = "too_large"
+	// The request body is not json.
+	ErrorKind_UNSUPPORTED_MEDIA_TYPE ErrorKind = "unsupported_media_type"
+)
+
+// The HTTP status code the kind of error maps to.
+func (k ErrorKind) Status () int {
+	switch k {
+	case ErrorKind_VALIDATION: return http.StatusBadRequest
+	case ErrorKind_NOT_FOUND: return http.StatusNotFound
+	case ErrorKind_CONFLICT: return http.StatusConflict
+	case ErrorKind_UNAUTHORIZED: return http.StatusUnauthorized
+	case ErrorKind_FORBIDDEN: return http.StatusForbidden
+	case ErrorKind_UNAVAILABLE: return http.StatusServiceUnavailable
+	case ErrorKind_TOO_LARGE: return http.StatusRequestEntityTooLarge
+	case ErrorKind_UNSUPPORTED_MEDIA_TYPE: return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+// The error of a single field of a request.
+type FieldError struct {
+	Field string `json:"field"`
+	Message string `json:"message"`
+}
+
+// An error with a kind telling callers how to handle it. The routes and data
+// providers return it for every error caused by the request or the backend.
+type Error struct {
+	Kind ErrorKind
+	// Machine readable identifier of the error, e.g. "invalid_constraint".
+	Code string
+	Message string
+	// The fields of the request at fault, if any.
+	Fields []*FieldError
+	// The underlying error, if any.
+	Err error
+}
+
+func (e *Error) Error () string {
+	return e.Message
+}
+
+func (e *Error) Unwrap () error {
+	return e.Err
+}
+
+// Attach the error of `field` to `e`.
+func (e *Error) WithField (field string, message string) *Error {
+	e.Fields = append(e.Fields, &FieldError{ Field: field, Message: message })
+	return e
+}
+
+// Build an error of `kind`. The message is formatted like `fmt.Errorf`,
+// and an error wrapped with "%w" becomes the underlying error.
+func new_error (kind ErrorKind, code string, format string, args ...interface{}) *Error {
+	formatted := fmt.Errorf(format, args...)
+	return &Error{ Kind: kind, Code: code, Message: formatted.Error(), Err: errors.Unwrap(formatted) }
+}
+
+func ValidationErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_VALIDATION, code, format, args...)
+}
+
+func NotFoundErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_NOT_FOUND, code, format, args...)
+}
+
+func ConflictErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_CONFLICT, code, format, args...)
+}
+
+func UnauthorizedErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_UNAUTHORIZED, code, format, args...)
+}
+
+func ForbiddenErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_FORBIDDEN, code, format, args...)
+}
+
+func TooLargeErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_TOO_LARGE, code, format, args...)
+}
+
+func UnsupportedMediaTypeErrorf (code string, format string, args ...interface{}) *Error {
+	return new_error(ErrorKind_UNSUPPORTED_MEDIA_TYPE, code, format, args...)
+}
+
+// Wrap the error of a backend that cannot be reached.
+func UnavailableError (err error) *Error {
+	return &Error{ Kind: ErrorKind_UNAVAILABLE, Code: "backend_unavailable", Message: fmt.Sprintf("backend unavailable: %s", err), Err: err }
+}
+
+// Return the kind of `err`. Errors that are not an `*Error` have no kind,
+// except a `*BulkInsertError` which is a validation error.
+func KindOf (err error) ErrorKind {
+	var typed *Error
+	if errors.As(err, &typed) { return typed.Kind }
+	var bulk_err *BulkInsertError
+	if errors.As(err, &bulk_err) { return ErrorKind_VALIDATION }
+	return ErrorKind_UNDEF
+}
+
+// An RFC 9457 problem details object.
+type Problem struct {
+	Type string `json:"type"`
+	Title string `json:"title"`
+	Status int `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extension members.
+	Code string `json:"code,omitempty"`
+	Errors []*FieldError `json:"errors,omitempty"`
+	Rows []*RowError `json:"rows,omitempty"`
+}
+
+// Describe `err` as a problem. The message of errors without a kind is not
+// disclosed, they are reported as internal errors.
+func NewProblem (err error) *Problem {
+	kind := KindOf(err)
+	problem := &Problem{
+		Type: "about:blank",
+		Status: kind.Status(),
+	}
+	problem.Title = http.StatusText(problem.Status)
+
+	var typed *Error
+	var bulk_err *BulkInsertError
+	switch {
+	case errors.As(err, &typed):
+		problem.Detail = typed.Message
+		problem.Code = typed.Code
+		problem.Errors = typed.Fields
+	case errors.As(err, &bulk_err):
+		problem.Detail = bulk_err.Error()
+		problem.Code = "rejected_entries"
+		problem.Rows = bulk_err.Errors
+	default:
+		problem.Code = "internal_error"
+	}
+	return problem
+}
+
+// Write `err` as an "application/problem+json" response.
+func WriteProblem (w http.ResponseWriter, instance string, err error) {
+	problem := NewProblem(err)
+	problem.Instance = instance
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
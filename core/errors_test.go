@@ -0,0 +1,67 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKinds (t *testing.T) {
+	cause := fmt.Errorf("connection refused")
+	err := fmt.Errorf("find: %w", UnavailableError(cause))
+	assert.Equal(t, ErrorKind_UNAVAILABLE, KindOf(err))
+	assert.ErrorIs(t, err, cause)
+	assert.Equal(t, http.StatusServiceUnavailable, KindOf(err).Status())
+
+	wrapped := ConflictErrorf("duplicate_key", "duplicate entry: %w", cause)
+	assert.Equal(t, "duplicate entry: connection refused", wrapped.Error())
+	assert.ErrorIs(t, wrapped, cause)
+
+	assert.Equal(t, ErrorKind_VALIDATION, KindOf(&BulkInsertError{}))
+	_, err = parse_route_params("id=%zz")
+	assert.Equal(t, ErrorKind_VALIDATION, KindOf(err))
+	assert.Equal(t, ErrorKind_UNDEF, KindOf(cause))
+	assert.Equal(t, http.StatusInternalServerError, KindOf(cause).Status())
+}
+
+func TestNewProblem (t *testing.T) {
+	problem := NewProblem(ValidationErrorf("invalid_param", "bad offset").WithField("offset", "negative"))
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "Bad Request", problem.Title)
+	assert.Equal(t, "bad offset", problem.Detail)
+	assert.Equal(t, "invalid_param", problem.Code)
+	assert.Equal(t, []*FieldError{{ Field: "offset", Message: "negative" }}, problem.Errors)
+
+	problem = NewProblem(&BulkInsertError{ Errors: []*RowError{{ Index: 1, Message: "bad" }} })
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "rejected_entries", problem.Code)
+	assert.Len(t, problem.Rows, 1)
+
+	// The message of untyped errors is not disclosed.
+	problem = NewProblem(fmt.Errorf("dial tcp 10.0.0.1:3306"))
+	assert.Equal(t, http.StatusInternalServerError, problem.Status)
+	assert.Equal(t, "internal_error", problem.Code)
+	assert.Empty(t, problem.Detail)
+}
+
+func TestWriteProblem (t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteProblem(w, "/api/users/findone", NotFoundErrorf("not_found", "no entries found"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]interface{}{
+		"type": "about:blank",
+		"title": "Not Found",
+		"status": float64(404),
+		"detail": "no entries found",
+		"instance": "/api/users/findone",
+		"code": "not_found",
+	}, body)
+}
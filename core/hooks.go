@@ -0,0 +1,82 @@
+package core
+
+// Business logic of a schema, run by the routes whatever the provider. Every
+// hook is optional, and an error returned by a hook aborts the request.
+type SchemaHooks struct {
+	// Called before entries are read, with the constraints of the read.
+	// Returns the constraints to read with, e.g. with an additional filter.
+	BeforeFind func(request *Request, constraints []Constraint) ([]Constraint, error)
+	// Called with the entries read, which it may alter, before they are
+	// served. Not called for aggregates and distinct values.
+	AfterFind func(request *Request, entries []map[string]interface{}) error
+	// Called before an entry is created, which it may alter, e.g. to stamp a
+	// "created_at" field. The entry is validated afterwards.
+	BeforeCreate func(request *Request, entry map[string]interface{}) error
+	// Called after an entry is created.
+	AfterCreate func(request *Request, entry map[string]interface{}) error
+	// Called before an entry is written over an existing one, which it may
+	// alter. The entry is validated afterwards.
+	BeforeUpdate func(request *Request, entry map[string]interface{}) error
+	// Called after an existing entry is updated.
+	AfterUpdate func(request *Request, entry map[string]interface{}) error
+	// Called before entries are deleted, with the constraints of the
+	// deletion. Returns the constraints to delete with.
+	BeforeDelete func(request *Request, constraints []Constraint) ([]Constraint, error)
+	// Called with the number of deleted entries.
+	AfterDelete func(request *Request, deleted int) error
+}
+
+// Run the hook before entries are read, then add the constraints of the
+// row filters, which the hook cannot remove.
+func (s *Schema) before_find (request *Request, constraints []Constraint) ([]Constraint, error) {
+	if s.Hooks != nil && s.Hooks.BeforeFind != nil {
+		var err error
+		constraints, err = s.Hooks.BeforeFind(request, constraints)
+		if err != nil { return nil, err }
+	}
+	row_constraints, err := s.row_constraints(request)
+	if err != nil { return nil, err }
+	return append(constraints, row_constraints...), nil
+}
+
+func (s *Schema) after_find (request *Request, entries []map[string]interface{}) error {
+	if s.Hooks == nil || s.Hooks.AfterFind == nil { return nil }
+	return s.Hooks.AfterFind(request, entries)
+}
+
+// Run the hooks before `entry` is written, then set the fields of the row
+// filters. An upsert may create or update, so it runs both hooks.
+func (s *Schema) before_write (request *Request, entry map[string]interface{}, create bool, update bool) error {
+	if s.Hooks != nil && create && s.Hooks.BeforeCreate != nil {
+		if err := s.Hooks.BeforeCreate(request, entry); err != nil { return err }
+	}
+	if s.Hooks != nil && update && s.Hooks.BeforeUpdate != nil {
+		if err := s.Hooks.BeforeUpdate(request, entry); err != nil { return err }
+	}
+	return s.apply_row_filters(request, entry)
+}
+
+func (s *Schema) after_write (request *Request, entry map[string]interface{}, created bool) error {
+	if s.Hooks == nil { return nil }
+	if created && s.Hooks.AfterCreate != nil { return s.Hooks.AfterCreate(request, entry) }
+	if !created && s.Hooks.AfterUpdate != nil { return s.Hooks.AfterUpdate(request, entry) }
+	return nil
+}
+
+// Run the hook before entries are deleted, then add the constraints of the
+// row filters, which the hook cannot remove.
+func (s *Schema) before_delete (request *Request, constraints []Constraint) ([]Constraint, error) {
+	if s.Hooks != nil && s.Hooks.BeforeDelete != nil {
+		var err error
+		constraints, err = s.Hooks.BeforeDelete(request, constraints)
+		if err != nil { return nil, err }
+	}
+	row_constraints, err := s.row_constraints(request)
+	if err != nil { return nil, err }
+	return append(constraints, row_constraints...), nil
+}
+
+func (s *Schema) after_delete (request *Request, deleted int) error {
+	if s.Hooks == nil || s.Hooks.AfterDelete == nil { return nil }
+	return s.Hooks.AfterDelete(request, deleted)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaHooks (t *testing.T) {
+	events := []string{}
+	users := &Schema{
+		Name: "Users",
+		Provider: CreateMemoryDataProvider([]map[string]interface{}{
+			{ "id": 1, "name": "John", "deleted": false },
+			{ "id": 2, "name": "Jimmy", "deleted": true },
+		}),
+		Fields: []*Field{
+			{ Name: "id", Type: FieldType_INT, PrimaryKey: true },
+			{ Name: "name", Type: FieldType_STRING },
+			{ Name: "deleted", Type: FieldType_BOOL },
+			{ Name: "updated_at", Type: FieldType_STRING, Required: true },
+			{ Name: "display_name", Type: FieldType_STRING, Nullable: true },
+		},
+		Hooks: &SchemaHooks{
+			// Soft deleted entries are never served.
+			BeforeFind: func (request *Request, constraints []Constraint) ([]Constraint, error) {
+				return append(constraints, Constraint{ Property: "deleted", Value: "false", Comparison: Comparison_EQ }), nil
+			},
+			AfterFind: func (request *Request, entries []map[string]interface{}) error {
+				for _, entry := range entries {
+					entry["display_name"] = "@" + entry["name"].(string)
+				}
+				return nil
+			},
+			BeforeCreate: func (request *Request, entry map[string]interface{}) error {
+				if entry["name"] == "root" { return ValidationErrorf("reserved_name", "name \"root\" is reserved").WithField("name", "reserved") }
+				entry["updated_at"] = "2026-10-19"
+				events = append(events, "before create")
+				return nil
+			},
+			AfterCreate: func (request *Request, entry map[string]interface{}) error {
+				events = append(events, "after create " + entry["name"].(string))
+				return nil
+			},
+			BeforeUpdate: func (request *Request, entry map[string]interface{}) error {
+				events = append(events, "before update")
+				return nil
+			},
+			AfterUpdate: func (request *Request, entry map[string]interface{}) error {
+				events = append(events, "after update " + entry["name"].(string))
+				return nil
+			},
+			// Only soft deleted entries are purged.
+			BeforeDelete: func (request *Request, constraints []Constraint) ([]Constraint, error) {
+				return append(constraints, Constraint{ Property: "deleted", Value: "true", Comparison: Comparison_EQ }), nil
+			},
+			AfterDelete: func (request *Request, deleted int) error {
+				events = append(events, fmt.Sprintf("after delete %d", deleted))
+				return nil
+			},
+		},
+		Deletable: true,
+	}
+	res, err := EasyApiImpl(&Config{ Schemas: []*Schema{ users } })
+	assert.NoError(t, err)
+
+	t.Run("find", func (t *testing.T) {
+		result, err := GetRoute(res, "/api/users/all").Action("")
+		assert.NoError(t, err)
+		entries := *result.(*[]map[string]interface{})
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "@John", entries[0]["display_name"])
+
+		_, err = GetRoute(res, "/api/users/findone").Action("name=-eq%20Jimmy")
+		assert.Equal(t, ErrorKind_NOT_FOUND, KindOf(err))
+
+		// Filtering the listed entries requires Find.
+		res, err := EasyApiImpl(&Config{ Schemas: []*Schema{{
+			Name: "Users",
+			Provider: &DataProvider{ All: users.Provider.All, FindOne: users.Provider.FindOne },
+			Hooks: users.Hooks,
+		}} })
+		assert.NoError(t, err)
+		_, err = GetRoute(res, "/api/users/all").Action("")
+		assert.Equal(t, "unsupported_find", NewProblem(err).Code)
+	});
+
+	t.Run("create", func (t *testing.T) {
+		events = []string{}
+		result, err := GetRoute(res, "/api/users/bulk").ActionWithBody("", []byte(`[{"id": 3, "name": "Alex", "deleted": false}]`))
+		assert.NoError(t, err)
+		assert.Equal(t, &BulkResult{ Inserted: 1 }, result)
+		assert.Equal(t, []string{ "before create", "after create Alex" }, events)
+
+		entry, err := GetRoute(res, "/api/users/findone").Action("id=-eq%203")
+		assert.NoError(t, err)
+		assert.Equal(t, "2026-10-19", (*entry.(*map[string]interface{}))["updated_at"])
+
+		_, err = GetRoute(res, "/api/users/bulk").ActionWithBody("", []byte(`[{"id": 4, "name": "Ana"}, {"id": 5, "name": "root"}]`))
+		var bulk_err *BulkInsertError
+		assert.ErrorAs(t, err, &bulk_err)
+		if bulk_err == nil { return }
+		assert.Equal(t, 1, bulk_err.Errors[0].Index)
+	});
+
+	t.Run("upsert", func (t *testing.T) {
+		events = []string{}
+		result, err := GetRoute(res, "/api/users/upsert").ActionWithBody("", []byte(`{"id": 1, "name": "Johnny", "deleted": false}`))
+		assert.NoError(t, err)
+		assert.Equal(t, &UpsertResult{ Created: false }, result)
+		assert.Equal(t, []string{ "before create", "before update", "after update Johnny" }, events)
+
+		_, err = GetRoute(res, "/api/users/upsert").ActionWithBody("", []byte(`{"id": 6, "name": "root"}`))
+		assert.Equal(t, "reserved_name", NewProblem(err).Code)
+	});
+
+	t.Run("included entries", func (t *testing.T) {
+		orders := &Schema{
+			Name: "Orders",
+			Provider: CreateMemoryDataProvider([]map[string]interface{}{
+				{ "id": 10, "user_id": json.Number("1") },
+				{ "id": 11, "user_id": json.Number("2") },
+			}),
+			Relations: []*Relation{
+				{ Name: "user", Type: RelationType_MANY_TO_ONE, Schema: "Users", Field: "user_id", ForeignField: "id" },
+			},
+		}
+		res, err := EasyApiImpl(&Config{ Schemas: []*Schema{ users, orders } })
+		assert.NoError(t, err)
+
+		result, err := GetRoute(res, "/api/orders/all").Action("include=user")
+		assert.NoError(t, err)
+		entries := *result.(*[]map[string]interface{})
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "@Johnny", entries[0]["user"].(map[string]interface{})["display_name"])
+		// The soft deleted user is not included.
+		assert.Nil(t, entries[1]["user"])
+	});
+
+	t.Run("delete", func (t *testing.T) {
+		events = []string{}
+		result, err := GetRoute(res, "/api/users/delete").Action("id=-in%201,2")
+		assert.NoError(t, err)
+		assert.Equal(t, &DeleteResult{ Deleted: 1 }, result)
+		assert.Equal(t, []string{ "after delete 1" }, events)
+
+		_, err = GetRoute(res, "/api/users/delete").Action("")
+		assert.Equal(t, "missing_constraints", NewProblem(err).Code)
+	});
+}
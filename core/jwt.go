@@ -0,0 +1,294 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	JwtAlgorithm_HS256 = "HS256"
+	JwtAlgorithm_RS256 = "RS256"
+	JwtAlgorithm_ES256 = "ES256"
+)
+
+// A key verifying the signature of tokens.
+type JwtKey struct {
+	// Matched against the "kid" header of tokens. A key without id verifies
+	// tokens of any id.
+	ID string
+	// One of the JwtAlgorithm_ constants. Tokens signed with another
+	// algorithm are not verified with the key.
+	Algorithm string
+	// A []byte secret for HS256, an *rsa.PublicKey for RS256 or an
+	// *ecdsa.PublicKey on the P-256 curve for ES256.
+	Key interface{}
+}
+
+type JwtConfig struct {
+	Keys []*JwtKey
+	// Path of a JWKS file holding more keys, read once.
+	JwksFile string
+	// The "iss" claim of tokens must be the issuer, if set.
+	Issuer string
+	// The "aud" claim of tokens must hold the audience, if set.
+	Audience string
+	// Tolerated clock skew when checking the "exp" and "nbf" claims.
+	Leeway time.Duration
+	// The claim holding the scopes of the principal, a space separated
+	// string or a list. The principal is unrestricted without the claim.
+	// Default: "scope"
+	ScopesClaim string
+	// The claim holding the roles of the principal, a space separated string
+	// or a list.
+	// Default: "roles"
+	RolesClaim string
+
+	now func() time.Time
+}
+
+// Decode a base64url encoded JWK member into a big integer.
+func decode_jwk_int (value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 { return nil, fmt.Errorf("invalid base64url value") }
+	return new(big.Int).SetBytes(b), nil
+}
+
+// The members of a JWK used to verify signatures. Other members, e.g. the
+// "x5c" certificate chain, are ignored.
+type json_web_key struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K string `json:"k"`
+	N string `json:"n"`
+	E string `json:"e"`
+	Crv string `json:"crv"`
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+// Convert a JWK of a JWKS into a key. Returns nil for keys that do not
+// verify signatures.
+func parse_jwk (jwk *json_web_key) (*JwtKey, error) {
+	if use := jwk.Use; len(use) > 0 && use != "sig" { return nil, nil }
+	key := &JwtKey{ ID: jwk.Kid, Algorithm: jwk.Alg }
+
+	switch jwk.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 { return nil, fmt.Errorf("invalid oct key \"%s\"", key.ID) }
+		if len(key.Algorithm) == 0 { key.Algorithm = JwtAlgorithm_HS256 }
+		key.Key = secret
+	case "RSA":
+		n, err := decode_jwk_int(jwk.N)
+		if err != nil { return nil, fmt.Errorf("invalid modulus of rsa key \"%s\"", key.ID) }
+		e, err := decode_jwk_int(jwk.E)
+		if err != nil || !e.IsInt64() { return nil, fmt.Errorf("invalid exponent of rsa key \"%s\"", key.ID) }
+		if len(key.Algorithm) == 0 { key.Algorithm = JwtAlgorithm_RS256 }
+		key.Key = &rsa.PublicKey{ N: n, E: int(e.Int64()) }
+	case "EC":
+		if jwk.Crv != "P-256" { return nil, fmt.Errorf("unsupported curve \"%s\" of ec key \"%s\"", jwk.Crv, key.ID) }
+		x, err := decode_jwk_int(jwk.X)
+		if err != nil { return nil, fmt.Errorf("invalid x of ec key \"%s\"", key.ID) }
+		y, err := decode_jwk_int(jwk.Y)
+		if err != nil { return nil, fmt.Errorf("invalid y of ec key \"%s\"", key.ID) }
+		if !elliptic.P256().IsOnCurve(x, y) { return nil, fmt.Errorf("ec key \"%s\" is not on the P-256 curve", key.ID) }
+		if len(key.Algorithm) == 0 { key.Algorithm = JwtAlgorithm_ES256 }
+		key.Key = &ecdsa.PublicKey{ Curve: elliptic.P256(), X: x, Y: y }
+	default:
+		return nil, nil
+	}
+	return key, nil
+}
+
+// Read the signature keys of a JWKS file.
+func read_jwks_file (file_path string) ([]*JwtKey, error) {
+	content, err := os.ReadFile(file_path)
+	if err != nil { return nil, err }
+	var jwks struct {
+		Keys []*json_web_key `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &jwks); err != nil { return nil, fmt.Errorf("invalid jwks file \"%s\": %w", file_path, err) }
+
+	keys := []*JwtKey{}
+	for _, jwk := range jwks.Keys {
+		key, err := parse_jwk(jwk)
+		if err != nil { return nil, fmt.Errorf("invalid jwks file \"%s\": %w", file_path, err) }
+		if key != nil { keys = append(keys, key) }
+	}
+	return keys, nil
+}
+
+// Check that `key` holds a key of the type its algorithm requires.
+func check_jwt_key (key *JwtKey) error {
+	ok := false
+	switch key.Algorithm {
+	case JwtAlgorithm_HS256:
+		secret, is_secret := key.Key.([]byte)
+		ok = is_secret && len(secret) > 0
+	case JwtAlgorithm_RS256:
+		_, ok = key.Key.(*rsa.PublicKey)
+	case JwtAlgorithm_ES256:
+		public_key, is_ec := key.Key.(*ecdsa.PublicKey)
+		ok = is_ec && public_key.Curve == elliptic.P256()
+	default:
+		return fmt.Errorf("unsupported algorithm \"%s\" of jwt key \"%s\"", key.Algorithm, key.ID)
+	}
+	if !ok { return fmt.Errorf("jwt key \"%s\" does not hold a %s key", key.ID, key.Algorithm) }
+	return nil
+}
+
+// Whether `signature` is the signature of `signed` with `key`.
+func verify_jwt_signature (key *JwtKey, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch key.Algorithm {
+	case JwtAlgorithm_HS256:
+		mac := hmac.New(sha256.New, key.Key.([]byte))
+		mac.Write([]byte(signed))
+		return hmac.Equal(mac.Sum(nil), signature)
+	case JwtAlgorithm_RS256:
+		return rsa.VerifyPKCS1v15(key.Key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case JwtAlgorithm_ES256:
+		// The signature is r and s, 32 bytes each.
+		if len(signature) != 64 { return false }
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key.Key.(*ecdsa.PublicKey), digest[:], r, s)
+	}
+	return false
+}
+
+// Read a numeric date claim, in seconds since the epoch.
+func jwt_time_claim (claims map[string]interface{}, name string) (time.Time, bool, error) {
+	value, exists := claims[name]
+	if !exists { return time.Time{}, false, nil }
+	seconds, ok := as_number(value)
+	if !ok { return time.Time{}, false, UnauthorizedErrorf("invalid_token", "claim \"%s\" must be a number", name) }
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// Whether the "aud" claim, a string or a list, holds `audience`.
+func jwt_has_audience (claims map[string]interface{}, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience { return true }
+		}
+	}
+	return false
+}
+
+// Read a list claim, e.g. the scopes of the principal. Nil without the claim.
+func jwt_list_claim (claims map[string]interface{}, claim string) []string {
+	switch scopes := claims[claim].(type) {
+	case string:
+		return strings.Fields(scopes)
+	case []interface{}:
+		list := []string{}
+		for _, scope := range scopes {
+			list = append(list, fmt.Sprint(scope))
+		}
+		return list
+	}
+	return nil
+}
+
+// Verify `token` and return its claims.
+func verify_jwt (token string, keys []*JwtKey, config *JwtConfig, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 { return nil, UnauthorizedErrorf("invalid_token", "malformed token") }
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID string `json:"kid"`
+	}
+	header_json, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(header_json, &header) != nil { return nil, UnauthorizedErrorf("invalid_token", "malformed token header") }
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil { return nil, UnauthorizedErrorf("invalid_token", "malformed token signature") }
+
+	// The key decides the algorithm, so that e.g. a public RSA key is never
+	// used as an HMAC secret.
+	verified := false
+	for _, key := range keys {
+		if key.Algorithm != header.Algorithm { continue }
+		if len(key.ID) > 0 && len(header.KeyID) > 0 && key.ID != header.KeyID { continue }
+		if verify_jwt_signature(key, parts[0] + "." + parts[1], signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified { return nil, UnauthorizedErrorf("invalid_token", "invalid token signature") }
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil { return nil, UnauthorizedErrorf("invalid_token", "malformed token payload") }
+	var claims map[string]interface{}
+	if err := decode_json(payload, &claims); err != nil || claims == nil { return nil, UnauthorizedErrorf("invalid_token", "malformed token payload") }
+
+	expires, found, err := jwt_time_claim(claims, "exp")
+	if err != nil { return nil, err }
+	if !found { return nil, UnauthorizedErrorf("invalid_token", "token has no expiration") }
+	if !now.Before(expires.Add(config.Leeway)) { return nil, UnauthorizedErrorf("token_expired", "token expired") }
+	not_before, found, err := jwt_time_claim(claims, "nbf")
+	if err != nil { return nil, err }
+	if found && now.Add(config.Leeway).Before(not_before) { return nil, UnauthorizedErrorf("invalid_token", "token not valid yet") }
+
+	if len(config.Issuer) > 0 && claims["iss"] != config.Issuer {
+		return nil, UnauthorizedErrorf("invalid_token", "unexpected token issuer")
+	}
+	if len(config.Audience) > 0 && !jwt_has_audience(claims, config.Audience) {
+		return nil, UnauthorizedErrorf("invalid_audience", "token is not intended for this audience")
+	}
+	return claims, nil
+}
+
+// Authenticate requests holding a valid JWT in an "Authorization: Bearer"
+// header. The subject of the token is the id of the principal.
+func JwtAuthenticator (config *JwtConfig) (Authenticator, error) {
+	if config == nil { return nil, fmt.Errorf("jwt config cannot be nil") }
+	cfg := *config
+	if len(cfg.ScopesClaim) == 0 { cfg.ScopesClaim = "scope" }
+	if len(cfg.RolesClaim) == 0 { cfg.RolesClaim = "roles" }
+	if cfg.now == nil { cfg.now = time.Now }
+
+	keys := append([]*JwtKey{}, cfg.Keys...)
+	if len(cfg.JwksFile) > 0 {
+		jwks_keys, err := read_jwks_file(cfg.JwksFile)
+		if err != nil { return nil, err }
+		keys = append(keys, jwks_keys...)
+	}
+	if len(keys) == 0 { return nil, fmt.Errorf("jwt authentication requires at least one key") }
+	for _, key := range keys {
+		if err := check_jwt_key(key); err != nil { return nil, err }
+	}
+
+	return func (request *Request) (*Principal, error) {
+		if request.Principal != nil { return nil, nil }
+		scheme, token, found := strings.Cut(request.Headers.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") { return nil, nil }
+
+		claims, err := verify_jwt(strings.TrimSpace(token), keys, &cfg, cfg.now())
+		if err != nil { return nil, err }
+		principal := &Principal{
+			Scopes: jwt_list_claim(claims, cfg.ScopesClaim),
+			Roles: jwt_list_claim(claims, cfg.RolesClaim),
+			Claims: claims,
+		}
+		if sub, ok := claims["sub"].(string); ok { principal.ID = sub }
+		return principal, nil
+	}, nil
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Sign `claims` into a token with the private `key` of `alg`.
+func sign_test_token (t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{ "alg": alg, "typ": "JWT", "kid": kid })
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case JwtAlgorithm_HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case JwtAlgorithm_RS256:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case JwtAlgorithm_ES256:
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		assert.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encode_jwk_int (i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestJwtAuthentication (t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	secret := []byte("a shared secret of the test suite")
+	rsa_key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ec_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{ "kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encode_jwk_int(rsa_key.N), "e": encode_jwk_int(big.NewInt(int64(rsa_key.E))), "key_ops": []string{ "verify" }, "x5c": []string{ "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA" } },
+			{ "kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode_jwk_int(ec_key.X), "y": encode_jwk_int(ec_key.Y) },
+			{ "kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB" },
+		},
+	})
+	jwks_file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwks_file, jwks, 0600))
+
+	config := &JwtConfig{
+		Keys: []*JwtKey{{ Algorithm: JwtAlgorithm_HS256, Key: secret }},
+		JwksFile: jwks_file,
+		Issuer: "https://id.example.com",
+		Audience: "easyapi",
+		Leeway: time.Minute,
+		now: func () time.Time { return now },
+	}
+	authenticator, err := JwtAuthenticator(config)
+	assert.NoError(t, err)
+
+	claims := func (overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "user-7",
+			"iss": "https://id.example.com",
+			"aud": []string{ "other", "easyapi" },
+			"exp": now.Add(time.Hour).Unix(),
+			"tenant": "acme",
+		}
+		for k, v := range overrides {
+			if v == nil { delete(c, k) } else { c[k] = v }
+		}
+		return c
+	}
+	authenticate := func (token string) (*Principal, error) {
+		return authenticator(&Request{ Headers: http.Header{ "Authorization": { "Bearer " + token } } })
+	}
+
+	t.Run("algorithms", func (t *testing.T) {
+		for _, token := range []string{
+			sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(nil)),
+			sign_test_token(t, JwtAlgorithm_RS256, "rsa-1", rsa_key, claims(nil)),
+			sign_test_token(t, JwtAlgorithm_ES256, "ec-1", ec_key, claims(nil)),
+		} {
+			principal, err := authenticate(token)
+			assert.NoError(t, err)
+			if principal == nil { continue }
+			assert.Equal(t, "user-7", principal.ID)
+			assert.Equal(t, "acme", principal.Claims["tenant"])
+			assert.Nil(t, principal.Scopes)
+		}
+	});
+
+	t.Run("scopes and roles", func (t *testing.T) {
+		principal, err := authenticate(sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{
+			"scope": "users:read orders:*",
+			"roles": []string{ "admin" },
+		})))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ "users:read", "orders:*" }, principal.Scopes)
+		assert.Equal(t, []string{ "admin" }, principal.Roles)
+	});
+
+	t.Run("rejected tokens", func (t *testing.T) {
+		other_key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		for code, token := range map[string]string{
+			"token_expired": sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{ "exp": now.Add(-2 * time.Minute).Unix() })),
+			"invalid_audience": sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{ "aud": "other" })),
+			"invalid_token": sign_test_token(t, JwtAlgorithm_HS256, "", []byte("another secret"), claims(nil)),
+		} {
+			_, err := authenticate(token)
+			assert.Equal(t, code, NewProblem(err).Code)
+			assert.Equal(t, ErrorKind_UNAUTHORIZED, KindOf(err))
+		}
+		for _, token := range []string{
+			sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{ "exp": nil })),
+			sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{ "nbf": now.Add(time.Hour).Unix() })),
+			sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{ "iss": "https://evil.example.com" })),
+			sign_test_token(t, JwtAlgorithm_ES256, "ec-1", other_key, claims(nil)),
+			// The public RSA key is not an HMAC secret.
+			sign_test_token(t, JwtAlgorithm_HS256, "rsa-1", rsa_key.PublicKey.N.Bytes(), claims(nil)),
+			sign_test_token(t, "none", "", secret, claims(nil)),
+			"not.a.token",
+		} {
+			_, err := authenticate(token)
+			assert.Equal(t, ErrorKind_UNAUTHORIZED, KindOf(err), token)
+		}
+
+		// Within the leeway.
+		_, err = authenticate(sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(map[string]interface{}{ "exp": now.Add(-30 * time.Second).Unix() })))
+		assert.NoError(t, err)
+	});
+
+	t.Run("without bearer token", func (t *testing.T) {
+		principal, err := authenticator(&Request{ Headers: http.Header{ "Authorization": { "Basic dXNlcjpwYXNz" } } })
+		assert.NoError(t, err)
+		assert.Nil(t, principal)
+	});
+
+	t.Run("routes", func (t *testing.T) {
+		// Providers read the claims of the request they serve.
+		memory := CreateMemoryDataProvider([]map[string]interface{}{{ "id": 1 }})
+		provider := *memory
+		served := false
+		provider.ForRequest = func (request *Request) *DataProvider {
+			served = request.Principal.Claims["tenant"] == "acme"
+			return memory
+		}
+		res, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{
+				Name: "Users",
+				Provider: &provider,
+				Hooks: &SchemaHooks{
+					BeforeFind: func (request *Request, constraints []Constraint) ([]Constraint, error) {
+						assert.Equal(t, "acme", request.Principal.Claims["tenant"])
+						return constraints, nil
+					},
+				},
+			}},
+			Authenticators: []Authenticator{ authenticator },
+		})
+		assert.NoError(t, err)
+		_, err = GetRoute(res, "/api/users/all").Handle(&Request{
+			Headers: http.Header{ "Authorization": { "Bearer " + sign_test_token(t, JwtAlgorithm_HS256, "", secret, claims(nil)) } },
+		})
+		assert.NoError(t, err)
+		assert.True(t, served)
+	});
+
+	t.Run("invalid config", func (t *testing.T) {
+		_, err := JwtAuthenticator(&JwtConfig{})
+		assert.ErrorContains(t, err, "at least one key")
+		_, err = JwtAuthenticator(&JwtConfig{ Keys: []*JwtKey{{ Algorithm: JwtAlgorithm_RS256, Key: secret }} })
+		assert.ErrorContains(t, err, "does not hold a RS256 key")
+		_, err = JwtAuthenticator(&JwtConfig{ Keys: []*JwtKey{{ Algorithm: "none" }} })
+		assert.ErrorContains(t, err, "unsupported algorithm")
+	});
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Convert a stored value into a float if it holds a number.
+func as_number (value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int: return float64(v), true
+	case int32: return float64(v), true
+	case int64: return float64(v), true
+	case uint64: return float64(v), true
+	case float32: return float64(v), true
+	case float64: return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Compare a stored value with the value of a constraint. Numbers are compared
+// numerically, everything else by its string representation.
+func compare_values (value interface{}, constraint_value string) int {
+	if number, ok := as_number(value); ok {
+		if other, err := strconv.ParseFloat(constraint_value, 64); err == nil {
+			switch {
+			case number < other: return -1
+			case number > other: return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(value), constraint_value)
+}
+
+func matches_constraint (entry map[string]interface{}, constraint Constraint) bool {
+	val := entry[constraint.Property]
+	switch constraint.Comparison {
+	case Comparison_NULL:
+		return val == nil
+	case Comparison_NOTNULL:
+		return val != nil
+	case Comparison_NE:
+		return val == nil || compare_values(val, constraint.Value) != 0
+	case Comparison_IN:
+		if val == nil { return false }
+		for _, v := range constraint.Values {
+			if compare_values(val, v) == 0 { return true }
+		}
+		return false
+	}
+
+	// NULL values never match a comparison with a value.
+	if val == nil { return false }
+	cmp := compare_values(val, constraint.Value)
+	switch constraint.Comparison {
+	case Comparison_EQ:
+		return cmp == 0
+	case Comparison_LT:
+		return cmp < 0
+	case Comparison_LE:
+		return cmp <= 0
+	case Comparison_GT:
+		return cmp > 0
+	case Comparison_GE:
+		return cmp >= 0
+	}
+	return false
+}
+
+func matches_constraints (entry map[string]interface{}, constraints []Constraint) bool {
+	for _, constraint := range constraints {
+		if !matches_constraint(entry, constraint) {
+			return false
+		}
+	}
+	return true
+}
+
+type memory_store struct {
+	mutex sync.RWMutex
+	entries []map[string]interface{}
+}
+
+// Create a data provider serving the entries of `payload` from memory.
+// The provider is the reference implementation of every `DataProvider` hook.
+func CreateMemoryDataProvider (payload []map[string]interface{}) *DataProvider {
+	store := &memory_store{ entries: copy_entries(payload) }
+
+	return &DataProvider{
+		All: func (offset int, count int) ([]map[string]interface{}, error) {
+			store.mutex.RLock()
+			defer store.mutex.RUnlock()
+
+			start := min(offset, len(store.entries))
+			end := min(start + count, len(store.entries))
+			return copy_entries(store.entries[start:end]), nil
+		},
+		FindOne: func (constraints []Constraint) (*map[string]interface{}, error) {
+			store.mutex.RLock()
+			defer store.mutex.RUnlock()
+
+			for _, entry := range store.entries {
+				if matches_constraints(entry, constraints) {
+					found := copy_entry(entry)
+					return &found, nil
+				}
+			}
+			return nil, NotFoundErrorf("not_found", "no matching entry found")
+		},
+		Find: func (constraints []Constraint, offset int, count int) ([]map[string]interface{}, error) {
+			store.mutex.RLock()
+			defer store.mutex.RUnlock()
+
+			found := []map[string]interface{}{}
+			for _, entry := range store.entries {
+				if matches_constraints(entry, constraints) { found = append(found, entry) }
+			}
+			start := min(offset, len(found))
+			end := min(start + count, len(found))
+			return copy_entries(found[start:end]), nil
+		},
+		InsertMany: func (entries []map[string]interface{}) (int, error) {
+			store.mutex.Lock()
+			defer store.mutex.Unlock()
+
+			bulk_err := &BulkInsertError{}
+			for i, entry := range entries {
+				if len(entry) == 0 {
+					bulk_err.Errors = append(bulk_err.Errors, &RowError{ Index: i, Message: "entry has no fields" })
+				}
+			}
+			if len(bulk_err.Errors) > 0 { return 0, bulk_err }
+
+			store.entries = append(store.entries, copy_entries(entries)...)
+			return len(entries), nil
+		},
+		Upsert: func (entry map[string]interface{}, keys []string) (bool, error) {
+			if len(keys) == 0 { return false, ValidationErrorf("missing_param", "at least one conflict key is required") }
+			constraints := []Constraint{}
+			for _, key := range keys {
+				value, ok := entry[key]
+				if !ok || value == nil { return false, ValidationErrorf("missing_field", "entry has no value for the conflict key \"%s\"", key).WithField(key, "missing value") }
+				constraints = append(constraints, Constraint{ Property: key, Value: fmt.Sprint(value), Comparison: Comparison_EQ })
+			}
+
+			store.mutex.Lock()
+			defer store.mutex.Unlock()
+
+			for _, existing := range store.entries {
+				if matches_constraints(existing, constraints) {
+					for k, v := range copy_entry(entry) {
+						existing[k] = v
+					}
+					return false, nil
+				}
+			}
+			store.entries = append(store.entries, copy_entry(entry))
+			return true, nil
+		},
+		Delete: func (constraints []Constraint) (int, error) {
+			store.mutex.Lock()
+			defer store.mutex.Unlock()
+
+			kept := []map[string]interface{}{}
+			for _, entry := range store.entries {
+				if !matches_constraints(entry, constraints) { kept = append(kept, entry) }
+			}
+			deleted := len(store.entries) - len(kept)
+			store.entries = kept
+			return deleted, nil
+		},
+		Aggregate: func (query *AggregateQuery) ([]map[string]interface{}, error) {
+			store.mutex.RLock()
+			defer store.mutex.RUnlock()
+			return aggregate_entries(store.entries, query), nil
+		},
+		Search: func (query *SearchQuery) ([]map[string]interface{}, error) {
+			store.mutex.RLock()
+			defer store.mutex.RUnlock()
+			return search_entries(store.entries, query), nil
+		},
+		Distinct: func (field string, constraints []Constraint, limit int) ([]*DistinctValue, error) {
+			store.mutex.RLock()
+			defer store.mutex.RUnlock()
+
+			rows := aggregate_entries(store.entries, &AggregateQuery{
+				GroupBy: []string{ field },
+				Metrics: []Metric{{ Function: AggregateFunction_COUNT, Field: "*" }},
+				Constraints: constraints,
+			})
+			values := []*DistinctValue{}
+			for _, row := range rows {
+				values = append(values, &DistinctValue{ Value: row[field], Count: row["count(*)"].(int) })
+			}
+			// Groups are ordered by value, keep that order among equal counts.
+			sort.SliceStable(values, func (i, j int) bool { return values[i].Count > values[j].Count })
+			if len(values) > limit { values = values[:limit] }
+			return values, nil
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Runs a route with a request: the next middleware of the chain, or the
+// action of the route.
+type Handler func(request *Request) (interface{}, error)
+
+// Wraps the action of a route. A middleware may inspect or alter the request
+// before calling `next`, the result and error after, or return without
+// calling `next` to reject the request. The url and path parameters of the
+// request are parsed, its body is decoded by the action.
+type Middleware func(route *RouteResult, request *Request, next Handler) (interface{}, error)
+
+// The middlewares of the `definition` route of `schema`: those of the
+// config, the authentication and authorization, then the schema, then the
+// route.
+func route_middlewares (config *Config, schema *Schema, definition string) []Middleware {
+	middlewares := []Middleware{}
+	middlewares = append(middlewares, config.Middlewares...)
+	if len(config.Authenticators) > 0 {
+		middlewares = append(middlewares, authentication_middleware(config.Authenticators))
+	}
+	if schema.Policy != nil {
+		middlewares = append(middlewares, authorization_middleware(schema))
+	}
+	middlewares = append(middlewares, schema.Middlewares...)
+	middlewares = append(middlewares, schema.RouteMiddlewares[definition]...)
+	return middlewares
+}
+
+// Check that the route middlewares of `schema` name request definitions.
+func check_route_middlewares (schema *Schema) error {
+	for name := range schema.RouteMiddlewares {
+		if !is_definition_name(name) { return fmt.Errorf("middlewares of schema \"%s\" set for unknown route \"%s\"", schema.Name, name) }
+	}
+	return nil
+}
+
+// Chain `middlewares` around `handler`, the first middleware outermost.
+func chain_middlewares (route *RouteResult, middlewares []Middleware, handler Handler) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		middleware, next := middlewares[i], handler
+		handler = func (request *Request) (interface{}, error) {
+			return middleware(route, request, next)
+		}
+	}
+	return handler
+}
+
+// Turn a panic of the rest of the chain into an internal error, rather than
+// crashing the server.
+func RecoverMiddleware (route *RouteResult, request *Request, next Handler) (result interface{}, err error) {
+	defer func () {
+		if recovered := recover(); recovered != nil {
+			result = nil
+			err = fmt.Errorf("panic in route \"%s\": %v\n%s", route.Route, recovered, debug.Stack())
+		}
+	}()
+	return next(request)
+}
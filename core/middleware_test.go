@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewares (t *testing.T) {
+	calls := []string{}
+	record := func (name string) Middleware {
+		return func (route *RouteResult, request *Request, next Handler) (interface{}, error) {
+			calls = append(calls, fmt.Sprintf("%s %s/%s", name, route.Schema().Name, route.Definition()))
+			result, err := next(request)
+			calls = append(calls, fmt.Sprintf("%s done", name))
+			return result, err
+		}
+	}
+
+	users := &Schema{
+		Name: "Users",
+		Provider: CreateMemoryDataProvider([]map[string]interface{}{
+			{ "id": 1, "name": "John" },
+			{ "id": 2, "name": "Jimmy" },
+		}),
+		Middlewares: []Middleware{ record("schema") },
+		RouteMiddlewares: map[string][]Middleware{
+			"findone": {
+				record("route"),
+				// Answers "name=-eq Nobody" without reaching the provider.
+				func (route *RouteResult, request *Request, next Handler) (interface{}, error) {
+					if name, _ := request.Params.Get("name"); name == "-eq Nobody" {
+						return nil, NotFoundErrorf("not_found", "nobody")
+					}
+					return next(request)
+				},
+			},
+		},
+	}
+	logs := &Schema{ Name: "Logs", Provider: CreateMemoryDataProvider(nil) }
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{ users, logs },
+		Middlewares: []Middleware{ RecoverMiddleware, record("global") },
+	})
+	assert.NoError(t, err)
+
+	t.Run("order", func (t *testing.T) {
+		calls = []string{}
+		result, err := GetRoute(res, "/api/users/findone").Action("name=-eq%20John")
+		assert.NoError(t, err)
+		assert.Equal(t, "John", (*result.(*map[string]interface{}))["name"])
+		assert.Equal(t, []string{
+			"global Users/findone",
+			"schema Users/findone",
+			"route Users/findone",
+			"route done",
+			"schema done",
+			"global done",
+		}, calls)
+
+		calls = []string{}
+		_, err = GetRoute(res, "/api/logs/all").Action("")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ "global Logs/all", "global done" }, calls)
+	});
+
+	t.Run("short circuit", func (t *testing.T) {
+		_, err := GetRoute(res, "/api/users/findone").Action("name=-eq%20Nobody")
+		assert.ErrorContains(t, err, "nobody")
+	});
+
+	t.Run("recover", func (t *testing.T) {
+		res, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{
+				Name: "Users",
+				Provider: &DataProvider{
+					All: func (offset int, count int) ([]map[string]interface{}, error) { panic("boom") },
+					FindOne: func (constraints []Constraint) (*map[string]interface{}, error) { return nil, nil },
+				},
+			}},
+			Middlewares: []Middleware{ RecoverMiddleware },
+		})
+		assert.NoError(t, err)
+		_, err = GetRoute(res, "/api/users/all").Action("")
+		assert.ErrorContains(t, err, "boom")
+		assert.Equal(t, ErrorKind_UNDEF, KindOf(err))
+	});
+
+	t.Run("unknown route", func (t *testing.T) {
+		_, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{
+				Name: "Users",
+				Provider: CreateMemoryDataProvider(nil),
+				RouteMiddlewares: map[string][]Middleware{ "purge": { RecoverMiddleware } },
+			}},
+		})
+		assert.ErrorContains(t, err, "unknown route \"purge\"")
+	});
+}
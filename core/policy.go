@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Maps roles to the request definitions they may run, "*" for every
+// definition, e.g. { "admin": {"*"}, "member": {"all", "findone"} }.
+type Policy map[string][]string
+
+func (t RequestType) String () string {
+	switch t {
+	case RequestType_GET: return "GET"
+	case RequestType_POST: return "POST"
+	}
+	return "UNDEF"
+}
+
+// Whether `name` is the name of a request definition.
+func is_definition_name (name string) bool {
+	for _, definition := range _requestDefinitions {
+		if definition.name == name { return true }
+	}
+	return false
+}
+
+// Check that the policy of `schema` names request definitions.
+func check_policy (schema *Schema) error {
+	for role, definitions := range schema.Policy {
+		for _, name := range definitions {
+			if name != "*" && !is_definition_name(name) {
+				return fmt.Errorf("policy of schema \"%s\" allows role \"%s\" an unknown route \"%s\"", schema.Name, role, name)
+			}
+		}
+	}
+	return nil
+}
+
+// The roles allowed to run `definition`, sorted.
+func (p Policy) roles (definition string) []string {
+	roles := []string{}
+	for role, definitions := range p {
+		if slices.Contains(definitions, "*") || slices.Contains(definitions, definition) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Check that the principal of `request` has a role allowed to run
+// `definition` on the entries of `s`, by the policy of `s` if any.
+func (s *Schema) authorize (request *Request, definition string) error {
+	if s.Policy == nil { return nil }
+	if request.Principal == nil {
+		return UnauthorizedErrorf("missing_credentials", "the request holds no credentials")
+	}
+	allowed := s.Policy.roles(definition)
+	for _, role := range request.Principal.Roles {
+		if slices.Contains(allowed, role) { return nil }
+	}
+	return ForbiddenErrorf("forbidden_role", "\"%s\" of schema \"%s\" requires one of the roles [%s]", definition, s.Name, strings.Join(allowed, ", "))
+}
+
+// Reject the requests whose principal has no role allowed to run the route
+// by the policy of `schema`.
+func authorization_middleware (schema *Schema) Middleware {
+	return func (route *RouteResult, request *Request, next Handler) (interface{}, error) {
+		if err := schema.authorize(request, route.Definition()); err != nil { return nil, err }
+		return next(request)
+	}
+}
+
+// The access rules of a route, for audits.
+type RoutePolicy struct {
+	Route string `json:"route"`
+	Method string `json:"method"`
+	Schema string `json:"schema"`
+	Definition string `json:"definition"`
+	// Whether the route requires credentials.
+	Authenticated bool `json:"authenticated"`
+	// The roles allowed to run the route, any role if nil.
+	Roles []string `json:"roles"`
+	// The fields restricted by the row filters of the schema.
+	RowFilters []string `json:"row_filters,omitempty"`
+}
+
+// List the access rules of every route, in route order.
+func (r *Result) Policy () []*RoutePolicy {
+	policies := []*RoutePolicy{}
+	for _, route := range r.Routes {
+		policy := &RoutePolicy{
+			Route: route.Route,
+			Method: route.Type.String(),
+			Schema: route._schema.Name,
+			Definition: route.Definition(),
+			Authenticated: route._authenticated || route._schema.Policy != nil || len(route._schema.RowFilters) > 0,
+		}
+		for _, filter := range route._schema.RowFilters {
+			policy.RowFilters = append(policy.RowFilters, filter.Field)
+		}
+		if route._schema.Policy != nil { policy.Roles = route._schema.Policy.roles(route.Definition()) }
+		policies = append(policies, policy)
+	}
+	return policies
+}
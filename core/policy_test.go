@@ -0,0 +1,117 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy (t *testing.T) {
+	store, err := StaticApiKeyStore([]*ApiKey{
+		{ ID: "alice", Hash: HashApiKey("alice-key"), Scopes: []string{ "*" }, Roles: []string{ "admin" } },
+		{ ID: "bob", Hash: HashApiKey("bob-key"), Scopes: []string{ "*" }, Roles: []string{ "member" } },
+		{ ID: "carol", Hash: HashApiKey("carol-key"), Scopes: []string{ "*" } },
+		{ ID: "dave", Hash: HashApiKey("dave-key"), Scopes: []string{ "users:all" }, Roles: []string{ "admin" } },
+	})
+	assert.NoError(t, err)
+	authenticator, err := ApiKeyAuthenticator(&ApiKeyConfig{ Store: store })
+	assert.NoError(t, err)
+
+	orders := &Schema{
+		Name: "Orders",
+		Provider: CreateMemoryDataProvider([]map[string]interface{}{{ "id": 10, "user_id": 1 }}),
+		Policy: Policy{
+			"admin": { "*" },
+			"member": { "all", "findone" },
+		},
+	}
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{
+			{
+				Name: "Users",
+				Provider: CreateMemoryDataProvider([]map[string]interface{}{{ "id": 1 }}),
+				Relations: []*Relation{
+					{ Name: "orders", Type: RelationType_ONE_TO_MANY, Schema: "Orders", Field: "id", ForeignField: "user_id" },
+				},
+			},
+			orders,
+		},
+		Authenticators: []Authenticator{ authenticator },
+	})
+	assert.NoError(t, err)
+
+	run := func (route string, key string, body string) error {
+		request := &Request{ Headers: http.Header{ "X-Api-Key": { key } } }
+		if len(body) > 0 { request.Body = []byte(body) }
+		_, err := GetRoute(res, route).Handle(request)
+		return err
+	}
+
+	assert.NoError(t, run("/api/orders/all", "alice-key", ""))
+	assert.NoError(t, run("/api/orders/bulk", "alice-key", `[{"id": 11}]`))
+	assert.NoError(t, run("/api/orders/all", "bob-key", ""))
+
+	err = run("/api/orders/bulk", "bob-key", `[{"id": 12}]`)
+	assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+	assert.Equal(t, "forbidden_role", NewProblem(err).Code)
+	assert.ErrorContains(t, err, "[admin]")
+	err = run("/api/orders/all", "carol-key", "")
+	assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+	// Schemas without policy are open to every authenticated client.
+	assert.NoError(t, run("/api/users/all", "carol-key", ""))
+
+	t.Run("included entries", func (t *testing.T) {
+		include := func (route string, key string) error {
+			request := &Request{ Params: CreateUrlParams(map[string][]string{ "include": { "orders" } }), Headers: http.Header{ "X-Api-Key": { key } } }
+			_, err := GetRoute(res, route).Handle(request)
+			return err
+		}
+		assert.NoError(t, include("/api/users/all", "bob-key"))
+		err := include("/api/users/all", "carol-key")
+		assert.Equal(t, "forbidden_role", NewProblem(err).Code)
+		err = include("/api/users/findone", "carol-key")
+		assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+		// The scopes of the key apply to the included schema as well.
+		err = include("/api/users/all", "dave-key")
+		assert.Equal(t, "insufficient_scope", NewProblem(err).Code)
+		assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+		// Nested routes run the policy of the related schema.
+		_, err = GetRoute(res, "/api/users/{id}/orders/all").Handle(&Request{
+			PathParams: map[string]string{ "id": "1" },
+			Headers: http.Header{ "X-Api-Key": { "carol-key" } },
+		})
+		assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+	});
+
+	policies := map[string]*RoutePolicy{}
+	for _, policy := range res.Policy() {
+		policies[policy.Route] = policy
+	}
+	assert.Equal(t, &RoutePolicy{
+		Route: "/api/orders/bulk",
+		Method: "POST",
+		Schema: "Orders",
+		Definition: "bulk",
+		Authenticated: true,
+		Roles: []string{ "admin" },
+	}, policies["/api/orders/bulk"])
+	assert.Equal(t, []string{ "admin", "member" }, policies["/api/orders/all"].Roles)
+	assert.Nil(t, policies["/api/users/all"].Roles)
+
+	t.Run("without authentication", func (t *testing.T) {
+		_, err := EasyApiImpl(&Config{ Schemas: []*Schema{ orders } })
+		assert.ErrorContains(t, err, "require at least one authenticator")
+	});
+
+	t.Run("unknown route", func (t *testing.T) {
+		_, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{
+				Name: "Orders",
+				Provider: CreateMemoryDataProvider(nil),
+				Policy: Policy{ "admin": { "purge" } },
+			}},
+		})
+		assert.ErrorContains(t, err, "unknown route \"purge\"")
+	});
+}
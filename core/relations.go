@@ -0,0 +1,178 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+type RelationType int
+const (
+	RelationType_UNDEF RelationType = 0
+	// Each entry relates to any number of entries of the other schema, e.g.
+	// a user and their orders. Included as a list.
+	RelationType_ONE_TO_MANY RelationType = 1
+	// Each entry relates to at most one entry of the other schema, e.g. an
+	// order and its user. Included as an entry, or null.
+	RelationType_MANY_TO_ONE RelationType = 2
+)
+
+// Maximum number of values of a single Comparison_IN constraint sent to a
+// provider when including related entries.
+const _includeBatchSize = 1000
+
+// A relation from the entries of a schema to the entries of another schema
+// holding the same value in `ForeignField` as the entry in `Field`.
+type Relation struct {
+	// The value of the "include" url parameter and the key the related
+	// entries are embedded under.
+	Name string
+	Type RelationType
+	// The name of the related schema.
+	Schema string
+	// The field of this schema's entries, e.g. "id" for a user's orders.
+	Field string
+	// The field of the related entries, e.g. "user_id" for a user's orders.
+	ForeignField string
+
+	_schema *Schema
+}
+
+// Return the relation named `name`, or nil if the schema does not declare it.
+func (s *Schema) Relation (name string) *Relation {
+	for _, r := range s.Relations {
+		if r.Name == name { return r }
+	}
+	return nil
+}
+
+// Check the relations of `schemas` and link them to the schema they point to.
+func resolve_relations (schemas []*Schema) error {
+	by_name := map[string]*Schema{}
+	for _, schema := range schemas {
+		by_name[schema.Name] = schema
+	}
+
+	for _, schema := range schemas {
+		names := map[string]bool{}
+		for _, r := range schema.Relations {
+			if len(r.Name) == 0 { return fmt.Errorf("relation name cannot be empty in schema \"%s\"", schema.Name) }
+			if names[r.Name] { return fmt.Errorf("duplicate relation \"%s\" in schema \"%s\"", r.Name, schema.Name) }
+			names[r.Name] = true
+			if r.Type != RelationType_ONE_TO_MANY && r.Type != RelationType_MANY_TO_ONE {
+				return fmt.Errorf("relation \"%s\" of schema \"%s\" has an unknown type", r.Name, schema.Name)
+			}
+			if len(schema.Fields) > 0 && schema.Field(r.Name) != nil {
+				return fmt.Errorf("relation \"%s\" of schema \"%s\" is named after one of its fields", r.Name, schema.Name)
+			}
+
+			related, ok := by_name[r.Schema]
+			if !ok { return fmt.Errorf("relation \"%s\" of schema \"%s\" points to unknown schema \"%s\"", r.Name, schema.Name, r.Schema) }
+			if len(r.Field) == 0 || len(r.ForeignField) == 0 {
+				return fmt.Errorf("relation \"%s\" of schema \"%s\" must set both Field and ForeignField", r.Name, schema.Name)
+			}
+			if len(schema.Fields) > 0 && schema.Field(r.Field) == nil {
+				return fmt.Errorf("relation \"%s\": unknown field \"%s\" in schema \"%s\"", r.Name, r.Field, schema.Name)
+			}
+			if len(related.Fields) > 0 && related.Field(r.ForeignField) == nil {
+				return fmt.Errorf("relation \"%s\": unknown field \"%s\" in schema \"%s\"", r.Name, r.ForeignField, related.Name)
+			}
+			r._schema = related
+		}
+	}
+	return nil
+}
+
+// Parse the comma separated "include" url parameter into the relations of
+// `schema`. Including entries reads them, so the client must be allowed to
+// list them ("all") or read one ("findone"), by its scopes and by the policy
+// of their schema.
+func parse_includes (request *Request, schema *Schema) ([]*Relation, error) {
+	relations := []*Relation{}
+	for _, name := range split_list_param(request.Params, "include") {
+		r := schema.Relation(name)
+		if r == nil { return nil, ValidationErrorf("unknown_relation", "schema \"%s\" has no relation \"%s\"", schema.Name, name).WithField("include", "unknown relation") }
+		if r._schema == nil || r._schema.Provider.Find == nil {
+			return nil, ValidationErrorf("unsupported_relation", "relation \"%s\" cannot be included, the provider of \"%s\" does not support Find", name, r.Schema).WithField("include", "unsupported relation")
+		}
+		definition := "all"
+		if r.Type == RelationType_MANY_TO_ONE { definition = "findone" }
+		if request.Principal != nil && !request.Principal.allows(r._schema, definition, RequestType_GET) {
+			return nil, ForbiddenErrorf("insufficient_scope", "the client is not allowed to include \"%s\"", name)
+		}
+		if err := r._schema.authorize(request, definition); err != nil { return nil, err }
+		relations = append(relations, r)
+	}
+	return relations, nil
+}
+
+// Key under which related entries are matched. Values are compared by their
+// string representation so that e.g. an int64 id matches a json.Number.
+func relation_key (value interface{}) string {
+	return fmt.Sprint(value)
+}
+
+// Fetch the entries of the related schema matching the `Field` of `entries`,
+// in batches of Comparison_IN constraints, grouped by relation key. The find
+// hooks of the related schema apply.
+func fetch_related (request *Request, entries []map[string]interface{}, r *Relation) (map[string][]map[string]interface{}, error) {
+	values := []string{}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		value := entry[r.Field]
+		if value == nil { continue }
+		key := relation_key(value)
+		if seen[key] { continue }
+		seen[key] = true
+		values = append(values, key)
+	}
+
+	related := map[string][]map[string]interface{}{}
+	for start := 0; start < len(values); start += _includeBatchSize {
+		batch := values[start:min(start + _includeBatchSize, len(values))]
+		constraints, err := r._schema.before_find(request, []Constraint{{
+			Property: r.ForeignField,
+			Comparison: Comparison_IN,
+			Values: batch,
+		}})
+		if err != nil { return nil, err }
+		found, err := r._schema.provider(request).Find(constraints, 0, math.MaxInt32)
+		if err != nil { return nil, err }
+		found, err = r._schema.filter_rows(request, found)
+		if err != nil { return nil, err }
+		if err := r._schema.after_find(request, found); err != nil { return nil, err }
+		for _, f := range found {
+			key := relation_key(f[r.ForeignField])
+			related[key] = append(related[key], f)
+		}
+		r._schema.redact_entries(request, found)
+	}
+	return related, nil
+}
+
+// Embed the entries related to `entries` through `relations`, with one
+// provider call per relation and batch of values.
+func include_relations (request *Request, entries []map[string]interface{}, relations []*Relation) error {
+	for _, r := range relations {
+		related, err := fetch_related(request, entries, r)
+		if err != nil { return err }
+
+		for _, entry := range entries {
+			var matches []map[string]interface{}
+			if value := entry[r.Field]; value != nil {
+				matches = related[relation_key(value)]
+			}
+			switch r.Type {
+			case RelationType_ONE_TO_MANY:
+				if matches == nil { matches = []map[string]interface{}{} }
+				entry[r.Name] = matches
+			case RelationType_MANY_TO_ONE:
+				if len(matches) == 0 {
+					entry[r.Name] = nil
+				} else {
+					entry[r.Name] = matches[0]
+				}
+			}
+		}
+	}
+	return nil
+}
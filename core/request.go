@@ -0,0 +1,63 @@
+package core
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Whether `media_type` is json, e.g. "application/json" or
+// "application/merge-patch+json".
+func is_json_media_type (media_type string) bool {
+	return media_type == "application/json" || (strings.HasPrefix(media_type, "application/") && strings.HasSuffix(media_type, "+json"))
+}
+
+// Check the "Content-Type" header of a request holding a body.
+func check_content_type (header string) error {
+	if len(header) == 0 {
+		return UnsupportedMediaTypeErrorf("unsupported_media_type", "missing content type, the request body must be json").WithField("Content-Type", "missing value")
+	}
+	media_type, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return UnsupportedMediaTypeErrorf("unsupported_media_type", "invalid content type \"%s\": %w", header, err).WithField("Content-Type", "invalid value")
+	}
+	if !is_json_media_type(media_type) {
+		return UnsupportedMediaTypeErrorf("unsupported_media_type", "unsupported content type \"%s\", the request body must be json", media_type).WithField("Content-Type", "not json")
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return UnsupportedMediaTypeErrorf("unsupported_media_type", "unsupported charset \"%s\", the request body must be utf-8", charset).WithField("Content-Type", "not utf-8")
+	}
+	return nil
+}
+
+// Build the request of the route from the http request `req`. `path_params`
+// are the values of the placeholders of the route, as matched by the router
+// the route is registered with. The body of a POST route must be json and
+// cannot exceed the maximum body size of the config, the body of a GET
+// route is ignored.
+func (r *RouteResult) ReadRequest (req *http.Request, path_params map[string]string) (*Request, error) {
+	request := &Request{
+		Params: CreateUrlParams(req.URL.Query()),
+		PathParams: path_params,
+		Headers: req.Header,
+	}
+	if r.Type != RequestType_POST || req.Body == nil || req.Body == http.NoBody { return request, nil }
+
+	max_size := r.max_body_size()
+	if req.ContentLength > max_size {
+		return nil, TooLargeErrorf("body_too_large", "request body exceeds %d bytes", max_size)
+	}
+	// Read one byte past the limit to tell a body of the maximum size from a
+	// larger one.
+	body, err := io.ReadAll(io.LimitReader(req.Body, max_size + 1))
+	if err != nil { return nil, ValidationErrorf("invalid_body", "failed to read the request body: %w", err) }
+	if int64(len(body)) > max_size {
+		return nil, TooLargeErrorf("body_too_large", "request body exceeds %d bytes", max_size)
+	}
+	if len(body) == 0 { return request, nil }
+
+	if err := check_content_type(req.Header.Get("Content-Type")); err != nil { return nil, err }
+	request.Body = body
+	return request, nil
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRequest (t *testing.T) {
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{{
+			Name: "Users",
+			Provider: CreateMemoryDataProvider([]map[string]interface{}{
+				{ "id": 1, "name": "John" },
+			}),
+			Fields: []*Field{
+				{ Name: "id", Type: FieldType_INT, PrimaryKey: true },
+				{ Name: "name", Type: FieldType_STRING },
+			},
+		}},
+		MaxBodySize: 64,
+	})
+	assert.NoError(t, err)
+	upsert_route := GetRoute(res, "/api/users/upsert")
+	findone_route := GetRoute(res, "/api/users/findone")
+
+	post := func (body string, content_type string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/upsert?key=id", strings.NewReader(body))
+		if len(content_type) > 0 { req.Header.Set("Content-Type", content_type) }
+		return req
+	}
+
+	t.Run("json body", func (t *testing.T) {
+		req := post(`{"id": 2, "name": "Jimmy"}`, "application/json; charset=utf-8")
+		req.Header.Set("X-Request-Id", "abc")
+		request, err := upsert_route.ReadRequest(req, nil)
+		assert.NoError(t, err)
+		if request == nil { return }
+		assert.Equal(t, "abc", request.Headers.Get("X-Request-Id"))
+		key, _ := request.Params.Get("key")
+		assert.Equal(t, "id", key)
+
+		result, err := upsert_route.Handle(request)
+		assert.NoError(t, err)
+		assert.Equal(t, &UpsertResult{ Created: true }, result)
+		assert.Equal(t, "Jimmy", request.Data.(map[string]interface{})["name"])
+	});
+
+	t.Run("query and headers of get routes", func (t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/findone?name=-eq%20John", nil)
+		request, err := findone_route.ReadRequest(req, nil)
+		assert.NoError(t, err)
+		if request == nil { return }
+		entry, err := findone_route.Handle(request)
+		assert.NoError(t, err)
+		assert.Equal(t, "John", (*entry.(*map[string]interface{}))["name"])
+	});
+
+	t.Run("content type", func (t *testing.T) {
+		for _, content_type := range []string{ "", "text/plain", "application/json; charset=latin1", "application/" } {
+			_, err := upsert_route.ReadRequest(post(`{"id": 3}`, content_type), nil)
+			assert.Equal(t, ErrorKind_UNSUPPORTED_MEDIA_TYPE, KindOf(err), content_type)
+		}
+		_, err := upsert_route.ReadRequest(post(`{"id": 3}`, "application/merge-patch+json"), nil)
+		assert.NoError(t, err)
+	});
+
+	t.Run("size limit", func (t *testing.T) {
+		body := `{"id": 3, "name": "` + strings.Repeat("a", 64) + `"}`
+		_, err := upsert_route.ReadRequest(post(body, "application/json"), nil)
+		assert.Equal(t, ErrorKind_TOO_LARGE, KindOf(err))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, NewProblem(err).Status)
+
+		// Without a content length, e.g. a chunked body.
+		req := post(body, "application/json")
+		req.ContentLength = -1
+		_, err = upsert_route.ReadRequest(req, nil)
+		assert.Equal(t, ErrorKind_TOO_LARGE, KindOf(err))
+
+		_, err = upsert_route.ActionWithBody("", []byte(body))
+		assert.Equal(t, ErrorKind_TOO_LARGE, KindOf(err))
+	});
+
+	t.Run("invalid json", func (t *testing.T) {
+		for _, body := range []string{ `{"id": 3`, `{"id": 3} {"id": 4}`, `[{"id": 3}]` } {
+			request, err := upsert_route.ReadRequest(post(body, "application/json"), nil)
+			assert.NoError(t, err)
+			if request == nil { continue }
+			_, err = upsert_route.Handle(request)
+			assert.Equal(t, ErrorKind_VALIDATION, KindOf(err), body)
+			assert.Equal(t, "invalid_body", NewProblem(err).Code, body)
+		}
+	});
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+)
+
+// Restricts the entries a client may read and write to those whose `Field`
+// holds the value computed from its principal, e.g. the entries of its tenant.
+type RowFilter struct {
+	Field string
+	// The value of the principal. An error rejects the request.
+	Value func(principal *Principal) (string, error)
+}
+
+// Filter on the value of the `claim` claim of the principal's token.
+func ClaimRowFilter (field string, claim string) *RowFilter {
+	return &RowFilter{
+		Field: field,
+		Value: func (principal *Principal) (string, error) {
+			value, ok := principal.Claims[claim]
+			if !ok || value == nil { return "", ForbiddenErrorf("row_filter", "the client has no \"%s\" claim", claim) }
+			return fmt.Sprint(value), nil
+		},
+	}
+}
+
+// Filter on the id of the principal, e.g. for entries owned by a client.
+func PrincipalRowFilter (field string) *RowFilter {
+	return &RowFilter{
+		Field: field,
+		Value: func (principal *Principal) (string, error) {
+			if len(principal.ID) == 0 { return "", ForbiddenErrorf("row_filter", "the client has no id") }
+			return principal.ID, nil
+		},
+	}
+}
+
+// Check the row filters of `schema`. Listing filtered entries requires the
+// provider to support Find.
+func check_row_filters (schema *Schema) error {
+	if len(schema.RowFilters) > 0 && schema.Provider.Find == nil {
+		return fmt.Errorf("row filters of schema \"%s\" require a provider supporting Find", schema.Name)
+	}
+	for _, filter := range schema.RowFilters {
+		if len(filter.Field) == 0 || filter.Value == nil {
+			return fmt.Errorf("row filters of schema \"%s\" must set both Field and Value", schema.Name)
+		}
+		if len(schema.Fields) > 0 && schema.Field(filter.Field) == nil {
+			return fmt.Errorf("row filter of schema \"%s\" on unknown field \"%s\"", schema.Name, filter.Field)
+		}
+	}
+	return nil
+}
+
+// The constraints of the row filters for the principal of `request`.
+func (s *Schema) row_constraints (request *Request) ([]Constraint, error) {
+	if len(s.RowFilters) == 0 { return nil, nil }
+	if request.Principal == nil {
+		return nil, UnauthorizedErrorf("missing_credentials", "the request holds no credentials")
+	}
+	constraints := []Constraint{}
+	for _, filter := range s.RowFilters {
+		value, err := filter.Value(request.Principal)
+		if err != nil { return nil, err }
+		constraints = append(constraints, Constraint{ Property: filter.Field, Value: value, Comparison: Comparison_EQ })
+	}
+	return constraints, nil
+}
+
+// Drop the entries the row filters hide from the client, should the provider
+// not have applied their constraints, e.g. ignoring unknown properties.
+func (s *Schema) filter_rows (request *Request, entries []map[string]interface{}) ([]map[string]interface{}, error) {
+	constraints, err := s.row_constraints(request)
+	if err != nil || len(constraints) == 0 { return entries, err }
+	filtered := []map[string]interface{}{}
+	for _, entry := range entries {
+		if matches_constraints(entry, constraints) { filtered = append(filtered, entry) }
+	}
+	return filtered, nil
+}
+
+// Set the fields of the row filters of a written `entry`. An entry holding
+// another value is rejected.
+func (s *Schema) apply_row_filters (request *Request, entry map[string]interface{}) error {
+	constraints, err := s.row_constraints(request)
+	if err != nil { return err }
+	for _, c := range constraints {
+		if value, exists := entry[c.Property]; exists && value != nil && compare_values(value, c.Value) != 0 {
+			return ForbiddenErrorf("row_filter", "field \"%s\" cannot be written with another value than the client's", c.Property).WithField(c.Property, "not the client's value")
+		}
+		entry[c.Property] = route_value(c.Value, s.Field(c.Property))
+	}
+	return nil
+}
+
+// Reject the upsert of `entry` over an existing entry the row filters hide
+// from the client.
+func (s *Schema) check_row_owner (request *Request, entry map[string]interface{}, keys []string) error {
+	constraints, err := s.row_constraints(request)
+	if err != nil || len(constraints) == 0 { return err }
+
+	key_constraints := []Constraint{}
+	for _, key := range keys {
+		key_constraints = append(key_constraints, Constraint{ Property: key, Value: fmt.Sprint(entry[key]), Comparison: Comparison_EQ })
+	}
+	existing, err := s.provider(request).FindOne(key_constraints)
+	if KindOf(err) == ErrorKind_NOT_FOUND { return nil }
+	if err != nil { return err }
+	if !matches_constraints(*existing, constraints) {
+		return ForbiddenErrorf("row_filter", "the entry belongs to another client")
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRowFilters (t *testing.T) {
+	// Authenticates the tenant named by a header, as a token would.
+	authenticator := func (request *Request) (*Principal, error) {
+		tenant := request.Headers.Get("X-Tenant")
+		if len(tenant) == 0 { return nil, nil }
+		return &Principal{ ID: tenant, Claims: map[string]interface{}{ "tenant": tenant } }, nil
+	}
+
+	orders := &Schema{
+		Name: "Orders",
+		Provider: CreateMemoryDataProvider([]map[string]interface{}{
+			{ "id": 10, "tenant_id": "acme", "user_id": 1, "item": "book" },
+			{ "id": 11, "tenant_id": "acme", "user_id": 2, "item": "pen" },
+			{ "id": 12, "tenant_id": "globex", "user_id": 1, "item": "cup" },
+		}),
+		Fields: []*Field{
+			{ Name: "id", Type: FieldType_INT, PrimaryKey: true },
+			{ Name: "tenant_id", Type: FieldType_STRING },
+			{ Name: "user_id", Type: FieldType_INT },
+			{ Name: "item", Type: FieldType_STRING, Searchable: true },
+		},
+		RowFilters: []*RowFilter{ ClaimRowFilter("tenant_id", "tenant") },
+	}
+	users := &Schema{
+		Name: "Users",
+		Provider: CreateMemoryDataProvider([]map[string]interface{}{{ "id": 1 }, { "id": 2 }}),
+		Relations: []*Relation{
+			{ Name: "orders", Type: RelationType_ONE_TO_MANY, Schema: "Orders", Field: "id", ForeignField: "user_id" },
+		},
+	}
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{ users, orders },
+		Authenticators: []Authenticator{ authenticator },
+	})
+	assert.NoError(t, err)
+
+	run := func (route string, tenant string, params string, body string) (interface{}, error) {
+		parsed, err := parse_route_params(params)
+		assert.NoError(t, err)
+		request := &Request{ Params: parsed, Headers: http.Header{ "X-Tenant": { tenant } } }
+		if len(body) > 0 { request.Body = []byte(body) }
+		return GetRoute(res, route).Handle(request)
+	}
+	items := func (result interface{}) []interface{} {
+		found := []interface{}{}
+		for _, entry := range *result.(*[]map[string]interface{}) {
+			found = append(found, entry["item"])
+		}
+		return found
+	}
+
+	t.Run("reads", func (t *testing.T) {
+		result, err := run("/api/orders/all", "acme", "", "")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{ "book", "pen" }, items(result))
+
+		_, err = run("/api/orders/findone", "acme", "id=-eq%2012", "")
+		assert.Equal(t, ErrorKind_NOT_FOUND, KindOf(err))
+
+		result, err = run("/api/orders/search", "globex", "q=book%20cup", "")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ "cup" }, items(result))
+
+		result, err = run("/api/orders/aggregate", "acme", "", "")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, (*result.(*[]map[string]interface{}))[0]["count(*)"])
+
+		// Included and nested entries are filtered as well.
+		result, err = run("/api/users/all", "globex", "include=orders", "")
+		assert.NoError(t, err)
+		entries := *result.(*[]map[string]interface{})
+		assert.Len(t, entries[0]["orders"], 1)
+		assert.Len(t, entries[1]["orders"], 0)
+		_, err = GetRoute(res, "/api/users/{id}/orders/findone").Handle(&Request{
+			PathParams: map[string]string{ "id": "2" },
+			Headers: http.Header{ "X-Tenant": { "globex" } },
+		})
+		assert.Equal(t, ErrorKind_NOT_FOUND, KindOf(err))
+	});
+
+	t.Run("writes", func (t *testing.T) {
+		_, err := run("/api/orders/bulk", "globex", "", `[{"id": 13, "user_id": 2, "item": "lamp"}]`)
+		assert.NoError(t, err)
+		result, err := run("/api/orders/findone", "globex", "id=-eq%2013", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "globex", (*result.(*map[string]interface{}))["tenant_id"])
+
+		_, err = run("/api/orders/bulk", "globex", "", `[{"id": 14, "tenant_id": "acme", "item": "mug"}]`)
+		assert.Equal(t, ErrorKind_FORBIDDEN, KindOf(err))
+
+		// The entry of another tenant cannot be overwritten.
+		_, err = run("/api/orders/upsert", "globex", "", `{"id": 10, "item": "stolen"}`)
+		assert.Equal(t, "row_filter", NewProblem(err).Code)
+		_, err = run("/api/orders/upsert", "acme", "", `{"id": 10, "item": "novel"}`)
+		assert.NoError(t, err)
+	});
+
+	t.Run("providers ignoring the filters", func (t *testing.T) {
+		// Serves every entry whatever the constraints.
+		memory := CreateMemoryDataProvider([]map[string]interface{}{
+			{ "id": 10, "tenant_id": "acme", "user_id": 1, "item": "book" },
+			{ "id": 12, "tenant_id": "globex", "user_id": 1, "item": "cup" },
+		})
+		provider := &DataProvider{
+			All: memory.All,
+			FindOne: func (constraints []Constraint) (*map[string]interface{}, error) { return memory.FindOne(nil) },
+			Find: func (constraints []Constraint, offset int, count int) ([]map[string]interface{}, error) {
+				return memory.All(offset, count)
+			},
+		}
+		res, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{
+				{ Name: "Orders", Provider: provider, RowFilters: orders.RowFilters },
+				{ Name: "Users", Provider: users.Provider, Relations: users.Relations },
+			},
+			Authenticators: []Authenticator{ authenticator },
+		})
+		assert.NoError(t, err)
+		handle := func (route string, params string) (interface{}, error) {
+			parsed, err := parse_route_params(params)
+			assert.NoError(t, err)
+			return GetRoute(res, route).Handle(&Request{ Params: parsed, Headers: http.Header{ "X-Tenant": { "globex" } } })
+		}
+
+		result, err := handle("/api/orders/all", "")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ "cup" }, items(result))
+		_, err = handle("/api/orders/findone", "")
+		assert.Equal(t, ErrorKind_NOT_FOUND, KindOf(err))
+		result, err = handle("/api/users/all", "include=orders")
+		assert.NoError(t, err)
+		assert.Len(t, (*result.(*[]map[string]interface{}))[0]["orders"], 1)
+	});
+
+	t.Run("without principal", func (t *testing.T) {
+		_, err := EasyApiImpl(&Config{ Schemas: []*Schema{ orders } })
+		assert.ErrorContains(t, err, "require at least one authenticator")
+
+		_, err = run("/api/orders/all", "", "", "")
+		assert.Equal(t, ErrorKind_UNAUTHORIZED, KindOf(err))
+	});
+
+	t.Run("provider without find", func (t *testing.T) {
+		_, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{
+				Name: "Orders",
+				Provider: &DataProvider{ All: orders.Provider.All, FindOne: orders.Provider.FindOne },
+				RowFilters: orders.RowFilters,
+			}},
+			Authenticators: []Authenticator{ authenticator },
+		})
+		assert.ErrorContains(t, err, "require a provider supporting Find")
+	});
+
+	t.Run("policy dump", func (t *testing.T) {
+		for _, policy := range res.Policy() {
+			if policy.Route == "/api/orders/all" {
+				assert.Equal(t, []string{ "tenant_id" }, policy.RowFilters)
+			}
+		}
+	});
+}
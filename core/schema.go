@@ -0,0 +1,79 @@
+package core
+
+import (
+	"regexp"
+)
+
+type FieldType int
+const (
+	FieldType_UNDEF FieldType = 0
+	FieldType_INT FieldType = 1
+	FieldType_STRING FieldType = 2
+	FieldType_FLOAT FieldType = 3
+	FieldType_DECIMAL FieldType = 4
+	FieldType_BOOL FieldType = 5
+	FieldType_DATE FieldType = 6
+	FieldType_DATETIME FieldType = 7
+	FieldType_JSON FieldType = 8
+	FieldType_BLOB FieldType = 9
+	FieldType_UUID FieldType = 10
+	FieldType_ENUM FieldType = 11
+)
+
+// Whether values of the field type are numbers.
+func (t FieldType) IsNumeric () bool {
+	return t == FieldType_INT || t == FieldType_FLOAT || t == FieldType_DECIMAL
+}
+
+// Definition of a field served by a schema.
+type Field struct {
+	Name string
+	Type FieldType
+	// Whether the field may hold null values.
+	Nullable bool
+	// Whether the field is part of the schema's primary key.
+	PrimaryKey bool
+	// Allowed values of an ENUM field.
+	Values []string
+	// Whether the "search" route looks for the searched text in the field.
+	Searchable bool
+
+	// Whether written entries must hold the field.
+	Required bool
+	// Bounds of the values of a numeric field, if set.
+	Min *float64
+	Max *float64
+	// Bounds of the number of characters of a string field. No bound if 0.
+	MinLength int
+	MaxLength int
+	// Regular expression the values of a string field must match. Not
+	// anchored: use "^...$" to match the whole value.
+	Pattern string
+
+	// Whether the field is served and written by the routes.
+	Visibility FieldVisibility
+	// If set, only clients with one of the roles read and write the field.
+	Roles []string
+	// Masks the served values, unless the client has one of `UnmaskedRoles`.
+	Mask FieldMask
+	UnmaskedRoles []string
+
+	_pattern *regexp.Regexp
+}
+
+// Return the field with the given `name`, or nil if the schema does not declare it.
+func (s *Schema) Field (name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name { return f }
+	}
+	return nil
+}
+
+// Return the names of the primary key fields, in declaration order.
+func (s *Schema) PrimaryKey () []string {
+	keys := []string{}
+	for _, f := range s.Fields {
+		if f.PrimaryKey { keys = append(keys, f.Name) }
+	}
+	return keys
+}
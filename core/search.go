@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type SearchQuery struct {
+	// The text to search for.
+	Text string
+	// The fields searched, the schema fields marked searchable.
+	Fields []string
+	// Only the entries matching every constraint are searched.
+	Constraints []Constraint
+	Offset int
+	Count int
+}
+
+// Split `text` into lower case words. Anything but letters and digits
+// separates words.
+func Tokenize (text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func (r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Parse the "q", "offset" and "count" url parameters, the other parameters
+// are constraints. Only the searchable fields the client reads unmasked are
+// searched.
+func parse_search_query (request *Request, schema *Schema) (*SearchQuery, error) {
+	route_params := request.Params
+	text, err := route_params.Get("q")
+	if err != nil { return nil, err }
+	if len(Tokenize(text)) == 0 { return nil, ValidationErrorf("invalid_param", "search text must hold at least one word").WithField("q", "no word") }
+
+	query := &SearchQuery{ Text: text }
+	for _, f := range schema.Fields {
+		if f.Searchable && f.can_read(request.Principal) && !f.is_masked(request.Principal) {
+			query.Fields = append(query.Fields, f.Name)
+		}
+	}
+	if len(query.Fields) == 0 {
+		return nil, ValidationErrorf("unsupported_route", "schema \"%s\" has no searchable field", schema.Name)
+	}
+
+	query.Offset, err = route_params.GetInt("offset")
+	if err != nil { query.Offset = 0 }
+	query.Count, err = route_params.GetInt("count")
+	if err != nil { query.Count = math.MaxInt32 }
+	if query.Offset < 0 || query.Count < 0 {
+		return nil, ValidationErrorf("invalid_param", "negative offset or count not allowed, offset = %d, count = %d", query.Offset, query.Count)
+	}
+
+	query.Constraints, err = parse_constraints(route_params, "q", "offset", "count")
+	if err != nil { return nil, err }
+	return query, nil
+}
+
+// Score an entry by the number of occurrences of the words of the query in
+// the searched fields.
+func search_score (entry map[string]interface{}, fields []string, words []string) int {
+	score := 0
+	for _, field := range fields {
+		value := entry[field]
+		if value == nil { continue }
+		for _, token := range Tokenize(fmt.Sprint(value)) {
+			for _, word := range words {
+				if token == word { score++ }
+			}
+		}
+	}
+	return score
+}
+
+// Search `entries` in process, most relevant entries first.
+func search_entries (entries []map[string]interface{}, query *SearchQuery) []map[string]interface{} {
+	words := Tokenize(query.Text)
+
+	type scored struct {
+		entry map[string]interface{}
+		score int
+	}
+	found := []scored{}
+	for _, entry := range entries {
+		if !matches_constraints(entry, query.Constraints) { continue }
+		if score := search_score(entry, query.Fields, words); score > 0 {
+			found = append(found, scored{ entry, score })
+		}
+	}
+	sort.SliceStable(found, func (i, j int) bool { return found[i].score > found[j].score })
+
+	results := []map[string]interface{}{}
+	start := min(query.Offset, len(found))
+	end := min(start + query.Count, len(found))
+	for _, f := range found[start:end] {
+		results = append(results, copy_entry(f.entry))
+	}
+	return results
+}
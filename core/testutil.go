@@ -1,6 +1,7 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -60,6 +61,24 @@ const (
 type TestSchemaDefinition struct {
 	FieldName string
 	FieldType TestSchemaFieldType
+	Nullable bool
+	// Whether no two entries may hold the same value for the field.
+	Unique bool
+	Searchable bool
+}
+
+// Convert the test schema into the fields declared by a `Schema`.
+func TestSchemaFields (schema []*TestSchemaDefinition) []*Field {
+	fields := []*Field{}
+	for _, s := range schema {
+		field := &Field{ Name: s.FieldName, Nullable: s.Nullable, Searchable: s.Searchable }
+		switch s.FieldType {
+		case TestSchemaFieldType_STRING: field.Type = FieldType_STRING
+		case TestSchemaFieldType_INT: field.Type = FieldType_INT
+		}
+		fields = append(fields, field)
+	}
+	return fields
 }
 
 func SetupDataProviderTests (
@@ -357,4 +376,852 @@ func SetupDataProviderTests (
 		assert.Equal(t, (*data)["name"], "John")
 		assert.Equal(t, (*data)["location"], "Arizona")
 	});
+
+	t.Run("error kinds", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{ "name": "John", "location": "Arizona" },
+		}
+		test_user_provider := data_provider_creator(t, UserSchemaDefinition(), payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		res, err := EasyApiImpl(&Config{
+			Schemas: []*Schema{{ Name: "Users", Provider: test_user_provider }},
+		})
+		assert.NoError(t, err, "Default config failed.")
+
+		_, err = GetRoute(res, "/api/users/findone").Action("name=\"-eq Nobody\"")
+		assert.Equal(t, ErrorKind_NOT_FOUND, KindOf(err), "%v", err)
+		_, err = GetRoute(res, "/api/users/findone").Action("name=\"-like John\"")
+		assert.Equal(t, ErrorKind_VALIDATION, KindOf(err), "%v", err)
+		_, err = GetRoute(res, "/api/users/all").Action("offset=-1")
+		assert.Equal(t, ErrorKind_VALIDATION, KindOf(err), "%v", err)
+		assert.Equal(t, "invalid_param", NewProblem(err).Code)
+	});
+
+	t.Run("null values", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{
+				"name": "John",
+				"location": nil,
+			}, {
+				"name": "Jimmy",
+				"location": "California",
+			},
+		}
+		schema := []*TestSchemaDefinition{
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING },
+			{ FieldName: "location", FieldType: TestSchemaFieldType_STRING, Nullable: true },
+		}
+
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: test_user_provider,
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		all_route := GetRoute(res, "/api/users/all")
+		assert.NotNil(t, all_route)
+		res_opaque, err := all_route.Action("")
+		assert.NoError(t, err)
+		data, ok := res_opaque.(*[]map[string]interface{})
+		assert.True(t, ok)
+		assert.Len(t, *data, 2)
+		for _, entry := range *data {
+			if entry["name"] == "John" {
+				assert.Nil(t, entry["location"])
+				encoded, err := json.Marshal(entry)
+				assert.NoError(t, err)
+				assert.Contains(t, string(encoded), `"location":null`)
+			}
+		}
+
+		findone_route := GetRoute(res, "/api/users/findone")
+		assert.NotNil(t, findone_route)
+
+		res_opaque, err = findone_route.Action("location=-null")
+		assert.NoError(t, err)
+		entry, ok := res_opaque.(*map[string]interface{})
+		assert.True(t, ok)
+		if entry == nil { return }
+		assert.Equal(t, "John", (*entry)["name"])
+
+		res_opaque, err = findone_route.Action("location=-notnull")
+		assert.NoError(t, err)
+		entry, ok = res_opaque.(*map[string]interface{})
+		assert.True(t, ok)
+		if entry == nil { return }
+		assert.Equal(t, "Jimmy", (*entry)["name"])
+
+		// Unlike plain SQL, "-ne" also matches NULL values.
+		res_opaque, err = findone_route.Action("location=\"-ne California\"")
+		assert.NoError(t, err)
+		entry, ok = res_opaque.(*map[string]interface{})
+		assert.True(t, ok)
+		if entry == nil { return }
+		assert.Equal(t, "John", (*entry)["name"])
+	});
+
+	t.Run("bulk insert", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		var kDataSize int = 3
+		payload, schema := GenerateTestUserPayload(kDataSize)
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: test_user_provider,
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		bulk_route := GetRoute(res, "/api/users/bulk")
+		if test_user_provider.InsertMany == nil {
+			assert.Nil(t, bulk_route, "bulk route served without InsertMany")
+			return
+		}
+		assert.NotNil(t, bulk_route)
+		if bulk_route == nil { return }
+		assert.Equal(t, RequestType_POST, bulk_route.Type)
+
+		new_users, _ := GenerateTestUserPayload(5)
+		body, err := json.Marshal(new_users)
+		assert.NoError(t, err)
+
+		res_opaque, err := bulk_route.ActionWithBody("", body)
+		assert.NoError(t, err)
+		result, ok := res_opaque.(*BulkResult)
+		assert.True(t, ok)
+		if result == nil { return }
+		assert.Equal(t, 5, result.Inserted)
+
+		all_route := GetRoute(res, "/api/users/all")
+		res_opaque, err = all_route.Action("")
+		assert.NoError(t, err)
+		data, ok := res_opaque.(*[]map[string]interface{})
+		assert.True(t, ok)
+		assert.Len(t, *data, kDataSize + 5)
+
+		// Entries that are not objects are reported, and nothing is inserted.
+		_, err = bulk_route.ActionWithBody("", []byte(`[{"name": "Alex", "location": "Texas"}, 5]`))
+		var bulk_err *BulkInsertError
+		assert.ErrorAs(t, err, &bulk_err)
+		if bulk_err != nil {
+			assert.Len(t, bulk_err.Errors, 1)
+			assert.Equal(t, 1, bulk_err.Errors[0].Index)
+		}
+
+		_, err = bulk_route.ActionWithBody("", []byte(`{"name": "Alex"}`))
+		assert.Error(t, err)
+		_, err = bulk_route.ActionWithBody("", []byte(`[]`))
+		assert.Error(t, err)
+
+		res_opaque, err = all_route.Action("")
+		assert.NoError(t, err)
+		data, _ = res_opaque.(*[]map[string]interface{})
+		assert.Len(t, *data, kDataSize + 5)
+	});
+	t.Run("upsert", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{
+				"name": "John",
+				"location": "Arizona",
+			}, {
+				"name": "Jimmy",
+				"location": "California",
+			},
+		}
+		schema := []*TestSchemaDefinition{
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING, Unique: true },
+			{ FieldName: "location", FieldType: TestSchemaFieldType_STRING },
+		}
+
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: test_user_provider,
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		upsert_route := GetRoute(res, "/api/users/upsert")
+		if test_user_provider.Upsert == nil {
+			assert.Nil(t, upsert_route, "upsert route served without Upsert")
+			return
+		}
+		assert.NotNil(t, upsert_route)
+		if upsert_route == nil { return }
+		assert.Equal(t, RequestType_POST, upsert_route.Type)
+
+		res_opaque, err := upsert_route.ActionWithBody("key=name", []byte(`{"name": "John", "location": "Nevada"}`))
+		assert.NoError(t, err)
+		result, ok := res_opaque.(*UpsertResult)
+		assert.True(t, ok)
+		if result == nil { return }
+		assert.False(t, result.Created)
+
+		res_opaque, err = upsert_route.ActionWithBody("key=name", []byte(`{"name": "Alex", "location": "Texas"}`))
+		assert.NoError(t, err)
+		result, _ = res_opaque.(*UpsertResult)
+		if result == nil { return }
+		assert.True(t, result.Created)
+
+		findone_route := GetRoute(res, "/api/users/findone")
+		res_opaque, err = findone_route.Action("name=\"-eq John\"")
+		assert.NoError(t, err)
+		entry, _ := res_opaque.(*map[string]interface{})
+		if entry == nil { return }
+		assert.Equal(t, "Nevada", (*entry)["location"])
+
+		all_route := GetRoute(res, "/api/users/all")
+		res_opaque, err = all_route.Action("")
+		assert.NoError(t, err)
+		data, _ := res_opaque.(*[]map[string]interface{})
+		assert.Len(t, *data, 3)
+
+		// The conflict key must hold a value.
+		_, err = upsert_route.ActionWithBody("key=name", []byte(`{"location": "Texas"}`))
+		assert.Error(t, err)
+		// The schema declares no primary key to default to.
+		_, err = upsert_route.ActionWithBody("", []byte(`{"name": "Alex", "location": "Ohio"}`))
+		assert.Error(t, err)
+		_, err = upsert_route.ActionWithBody("key=name", []byte(`[{"name": "Alex"}]`))
+		assert.Error(t, err)
+	});
+	t.Run("delete", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{ "name": "John", "location": "Arizona" },
+			{ "name": "Jimmy", "location": "California" },
+			{ "name": "Alex", "location": "Arizona" },
+		}
+		schema := []*TestSchemaDefinition{
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING },
+			{ FieldName: "location", FieldType: TestSchemaFieldType_STRING },
+		}
+
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		res, err := EasyApiImpl(&Config{ Schemas: []*Schema{{ Name: "Users", Provider: test_user_provider }} })
+		assert.NoError(t, err, "Default config failed.")
+		assert.Nil(t, GetRoute(res, "/api/users/delete"), "delete route served by default")
+
+		res, err = EasyApiImpl(&Config{ Schemas: []*Schema{{ Name: "Users", Provider: test_user_provider, Deletable: true }} })
+		assert.NoError(t, err)
+		delete_route := GetRoute(res, "/api/users/delete")
+		if test_user_provider.Delete == nil {
+			assert.Nil(t, delete_route, "delete route served without Delete")
+			return
+		}
+		assert.NotNil(t, delete_route)
+		if delete_route == nil { return }
+		assert.Equal(t, RequestType_POST, delete_route.Type)
+
+		res_opaque, err := delete_route.Action("location=\"-eq Arizona\"")
+		assert.NoError(t, err)
+		assert.Equal(t, &DeleteResult{ Deleted: 2 }, res_opaque)
+
+		res_opaque, err = GetRoute(res, "/api/users/all").Action("")
+		assert.NoError(t, err)
+		data, _ := res_opaque.(*[]map[string]interface{})
+		if data == nil { return }
+		assert.Len(t, *data, 1)
+
+		// Deleting every entry requires a constraint.
+		_, err = delete_route.Action("")
+		assert.Equal(t, ErrorKind_VALIDATION, KindOf(err))
+	});
+	t.Run("aggregate", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{ "name": "John", "location": "Arizona", "age": 30 },
+			{ "name": "Jimmy", "location": "Arizona", "age": 20 },
+			{ "name": "Alex", "location": "Texas", "age": 40 },
+			{ "name": "Sam", "location": "Texas", "age": nil },
+		}
+		schema := []*TestSchemaDefinition{
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING },
+			{ FieldName: "location", FieldType: TestSchemaFieldType_STRING },
+			{ FieldName: "age", FieldType: TestSchemaFieldType_INT, Nullable: true },
+		}
+
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: test_user_provider,
+					Fields: TestSchemaFields(schema),
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		aggregate_route := GetRoute(res, "/api/users/aggregate")
+		if test_user_provider.Aggregate == nil {
+			assert.Nil(t, aggregate_route, "aggregate route served without Aggregate")
+			return
+		}
+		assert.NotNil(t, aggregate_route)
+		if aggregate_route == nil { return }
+		assert.Equal(t, RequestType_GET, aggregate_route.Type)
+
+		number := func (value interface{}) float64 {
+			n, ok := as_number(value)
+			assert.True(t, ok, "expected a number, received %#v", value)
+			return n
+		}
+
+		res_opaque, err := aggregate_route.Action("group_by=location&metrics=count(*),count(age),avg(age),max(age)")
+		assert.NoError(t, err)
+		rows, ok := res_opaque.(*[]map[string]interface{})
+		assert.True(t, ok)
+		if rows == nil { return }
+		assert.Len(t, *rows, 2)
+		for _, row := range *rows {
+			switch row["location"] {
+			case "Arizona":
+				assert.Equal(t, 2.0, number(row["count(*)"]))
+				assert.Equal(t, 25.0, number(row["avg(age)"]))
+				assert.Equal(t, 30.0, number(row["max(age)"]))
+			case "Texas":
+				// Null values are ignored by every metric but count(*).
+				assert.Equal(t, 2.0, number(row["count(*)"]))
+				assert.Equal(t, 1.0, number(row["count(age)"]))
+				assert.Equal(t, 40.0, number(row["avg(age)"]))
+			default:
+				assert.Fail(t, "unexpected group", "%#v", row)
+			}
+		}
+
+		res_opaque, err = aggregate_route.Action("metrics=sum(age)&age=\"-gt 20\"")
+		assert.NoError(t, err)
+		rows, _ = res_opaque.(*[]map[string]interface{})
+		if rows == nil { return }
+		assert.Len(t, *rows, 1)
+		assert.Equal(t, 70.0, number((*rows)[0]["sum(age)"]))
+
+		// The metrics default to count(*).
+		res_opaque, err = aggregate_route.Action("")
+		assert.NoError(t, err)
+		rows, _ = res_opaque.(*[]map[string]interface{})
+		if rows == nil { return }
+		assert.Len(t, *rows, 1)
+		assert.Equal(t, 4.0, number((*rows)[0]["count(*)"]))
+
+		_, err = aggregate_route.Action("metrics=avg(name)")
+		assert.ErrorContains(t, err, "numeric")
+		_, err = aggregate_route.Action("group_by=height")
+		assert.ErrorContains(t, err, "unknown field")
+		_, err = aggregate_route.Action("metrics=median(age)")
+		assert.ErrorContains(t, err, "unknown aggregate function")
+		_, err = aggregate_route.Action("metrics=sum(*)")
+		assert.Error(t, err)
+	});
+	t.Run("distinct", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{ "name": "John", "location": "Arizona" },
+			{ "name": "Jimmy", "location": "Arizona" },
+			{ "name": "Alex", "location": "Texas" },
+			{ "name": "Sam", "location": "Arizona" },
+			{ "name": "Mary", "location": "Texas" },
+			{ "name": "Kim", "location": nil },
+		}
+		schema := []*TestSchemaDefinition{
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING },
+			{ FieldName: "location", FieldType: TestSchemaFieldType_STRING, Nullable: true },
+		}
+
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: test_user_provider,
+					Fields: TestSchemaFields(schema),
+				}, {
+					Name: "Capped",
+					Provider: test_user_provider,
+					MaxDistinctValues: 2,
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		distinct_route := GetRoute(res, "/api/users/distinct")
+		if test_user_provider.Distinct == nil {
+			assert.Nil(t, distinct_route, "distinct route served without Distinct")
+			return
+		}
+		assert.NotNil(t, distinct_route)
+		if distinct_route == nil { return }
+		assert.Equal(t, RequestType_GET, distinct_route.Type)
+
+		res_opaque, err := distinct_route.Action("field=location")
+		assert.NoError(t, err)
+		values, ok := res_opaque.(*[]*DistinctValue)
+		assert.True(t, ok)
+		if values == nil { return }
+		assert.Len(t, *values, 3)
+		if len(*values) == 3 {
+			assert.Equal(t, DistinctValue{ Value: "Arizona", Count: 3 }, *(*values)[0])
+			assert.Equal(t, DistinctValue{ Value: "Texas", Count: 2 }, *(*values)[1])
+			assert.Equal(t, DistinctValue{ Value: nil, Count: 1 }, *(*values)[2])
+		}
+
+		res_opaque, err = distinct_route.Action("field=location&name=\"-ge Kim\"")
+		assert.NoError(t, err)
+		values, _ = res_opaque.(*[]*DistinctValue)
+		if values == nil { return }
+		counts := map[interface{}]int{}
+		for _, v := range *values {
+			counts[v.Value] = v.Count
+		}
+		assert.Equal(t, map[interface{}]int{ "Texas": 1, "Arizona": 1, nil: 1 }, counts)
+
+		_, err = distinct_route.Action("")
+		assert.Error(t, err)
+		_, err = distinct_route.Action("field=height")
+		assert.ErrorContains(t, err, "unknown field")
+
+		capped_route := GetRoute(res, "/api/capped/distinct")
+		assert.NotNil(t, capped_route)
+		_, err = capped_route.Action("field=location")
+		assert.ErrorContains(t, err, "more than 2 distinct values")
+		res_opaque, err = capped_route.Action("field=location&location=-notnull")
+		assert.NoError(t, err)
+		values, _ = res_opaque.(*[]*DistinctValue)
+		if values == nil { return }
+		assert.Len(t, *values, 2)
+	});
+	t.Run("search", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		payload := []map[string]interface{}{
+			{ "name": "John Smith", "location": "Phoenix, Arizona", "note": "John" },
+			{ "name": "Jimmy Page", "location": "San Diego, California", "note": "Arizona" },
+			{ "name": "Alex Arizona", "location": "Tucson, Arizona", "note": "" },
+			{ "name": "Sam Jones", "location": "Austin, Texas", "note": "" },
+		}
+		schema := []*TestSchemaDefinition{
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING, Searchable: true },
+			{ FieldName: "location", FieldType: TestSchemaFieldType_STRING, Searchable: true },
+			{ FieldName: "note", FieldType: TestSchemaFieldType_STRING },
+		}
+
+		test_user_provider := data_provider_creator(t, schema, payload, &ctx)
+		assert.NotNil(t, test_user_provider, "Failed to create data provider")
+		if test_user_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: test_user_provider,
+					Fields: TestSchemaFields(schema),
+				}, {
+					Name: "Unsearchable",
+					Provider: test_user_provider,
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		search_route := GetRoute(res, "/api/users/search")
+		if test_user_provider.Search == nil {
+			assert.Nil(t, search_route, "search route served without Search")
+			return
+		}
+		assert.NotNil(t, search_route)
+		if search_route == nil { return }
+		assert.Equal(t, RequestType_GET, search_route.Type)
+
+		names := func (res_opaque interface{}) []interface{} {
+			data, ok := res_opaque.(*[]map[string]interface{})
+			assert.True(t, ok)
+			found := []interface{}{}
+			if data == nil { return found }
+			for _, entry := range *data {
+				found = append(found, entry["name"])
+			}
+			return found
+		}
+
+		// Fields that are not searchable are ignored.
+		res_opaque, err := search_route.Action("q=arizona")
+		assert.NoError(t, err)
+		found := names(res_opaque)
+		assert.Len(t, found, 2)
+		if len(found) == 2 {
+			// Alex matches the word in two fields.
+			assert.Equal(t, "Alex Arizona", found[0])
+			assert.Equal(t, "John Smith", found[1])
+		}
+
+		res_opaque, err = search_route.Action("q=Texas%20jimmy")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{ "Sam Jones", "Jimmy Page" }, names(res_opaque))
+
+		res_opaque, err = search_route.Action("q=arizona&count=1")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ "Alex Arizona" }, names(res_opaque))
+
+		res_opaque, err = search_route.Action("q=arizona&note=\"-ne John\"")
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ "Alex Arizona" }, names(res_opaque))
+
+		res_opaque, err = search_route.Action("q=Nevada")
+		assert.NoError(t, err)
+		assert.Empty(t, names(res_opaque))
+
+		_, err = search_route.Action("")
+		assert.Error(t, err)
+		_, err = search_route.Action("q=%20,%20")
+		assert.Error(t, err)
+		_, err = GetRoute(res, "/api/unsearchable/search").Action("q=arizona")
+		assert.ErrorContains(t, err, "no searchable field")
+	});
+	t.Run("include relations", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		users := []map[string]interface{}{
+			{ "id": 1, "name": "John" },
+			{ "id": 2, "name": "Jimmy" },
+			{ "id": 3, "name": "Alex" },
+		}
+		users_schema := []*TestSchemaDefinition{
+			{ FieldName: "id", FieldType: TestSchemaFieldType_INT },
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING },
+		}
+		orders := []map[string]interface{}{
+			{ "id": 10, "user_id": 1, "item": "book" },
+			{ "id": 11, "user_id": 1, "item": "pen" },
+			{ "id": 12, "user_id": 2, "item": "cup" },
+			{ "id": 13, "user_id": 9, "item": "lamp" },
+		}
+		orders_schema := []*TestSchemaDefinition{
+			{ FieldName: "id", FieldType: TestSchemaFieldType_INT },
+			{ FieldName: "user_id", FieldType: TestSchemaFieldType_INT },
+			{ FieldName: "item", FieldType: TestSchemaFieldType_STRING },
+		}
+
+		users_provider := data_provider_creator(t, users_schema, users, &ctx)
+		orders_provider := data_provider_creator(t, orders_schema, orders, &ctx)
+		assert.NotNil(t, users_provider, "Failed to create data provider")
+		assert.NotNil(t, orders_provider, "Failed to create data provider")
+		if users_provider == nil || orders_provider == nil {  return }
+
+		// Count the provider calls to check that related entries are batched.
+		var find_calls int
+		if orders_provider.Find != nil {
+			counted := *orders_provider
+			find := orders_provider.Find
+			counted.Find = func (constraints []Constraint, offset int, count int) ([]map[string]interface{}, error) {
+				find_calls++
+				return find(constraints, offset, count)
+			}
+			orders_provider = &counted
+		}
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: users_provider,
+					Fields: TestSchemaFields(users_schema),
+					Relations: []*Relation{
+						{ Name: "orders", Type: RelationType_ONE_TO_MANY, Schema: "Orders", Field: "id", ForeignField: "user_id" },
+					},
+				}, {
+					Name: "Orders",
+					Provider: orders_provider,
+					Fields: TestSchemaFields(orders_schema),
+					Relations: []*Relation{
+						{ Name: "user", Type: RelationType_MANY_TO_ONE, Schema: "Users", Field: "user_id", ForeignField: "id" },
+					},
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		users_all := GetRoute(res, "/api/users/all")
+		assert.NotNil(t, users_all)
+		if users_all == nil { return }
+		if orders_provider.Find == nil {
+			_, err = users_all.Action("include=orders")
+			assert.ErrorContains(t, err, "does not support Find")
+			return
+		}
+
+		number := func (value interface{}) float64 {
+			n, _ := as_number(value)
+			return n
+		}
+		items := func (value interface{}) []interface{} {
+			related, ok := value.([]map[string]interface{})
+			assert.True(t, ok, "expected a list of entries, received %#v", value)
+			found := []interface{}{}
+			for _, r := range related {
+				found = append(found, r["item"])
+			}
+			return found
+		}
+
+		res_opaque, err := users_all.Action("include=orders")
+		assert.NoError(t, err)
+		data, _ := res_opaque.(*[]map[string]interface{})
+		if data == nil { return }
+		assert.Len(t, *data, 3)
+		for _, user := range *data {
+			switch number(user["id"]) {
+			case 1: assert.ElementsMatch(t, []interface{}{ "book", "pen" }, items(user["orders"]))
+			case 2: assert.ElementsMatch(t, []interface{}{ "cup" }, items(user["orders"]))
+			case 3: assert.Empty(t, items(user["orders"]))
+			}
+		}
+		assert.Equal(t, 1, find_calls)
+
+		users_findone := GetRoute(res, "/api/users/findone")
+		res_opaque, err = users_findone.Action("name=\"-eq Jimmy\"&include=orders")
+		assert.NoError(t, err)
+		user, _ := res_opaque.(*map[string]interface{})
+		if user == nil { return }
+		assert.Equal(t, []interface{}{ "cup" }, items((*user)["orders"]))
+
+		// Without include, nothing is embedded.
+		res_opaque, err = users_all.Action("")
+		assert.NoError(t, err)
+		data, _ = res_opaque.(*[]map[string]interface{})
+		if data == nil { return }
+		assert.NotContains(t, (*data)[0], "orders")
+
+		if users_provider.Find != nil {
+			res_opaque, err = GetRoute(res, "/api/orders/all").Action("include=user")
+			assert.NoError(t, err)
+			data, _ = res_opaque.(*[]map[string]interface{})
+			if data == nil { return }
+			assert.Len(t, *data, 4)
+			for _, order := range *data {
+				related, _ := order["user"].(map[string]interface{})
+				switch number(order["id"]) {
+				case 10: assert.Equal(t, "John", related["name"])
+				case 12: assert.Equal(t, "Jimmy", related["name"])
+				case 13: assert.Nil(t, order["user"])
+				}
+			}
+		}
+
+		_, err = users_all.Action("include=invoices")
+		assert.ErrorContains(t, err, "no relation")
+
+		config.Schemas[0].Relations[0].Schema = "Invoices"
+		_, err = EasyApiImpl(config)
+		assert.ErrorContains(t, err, "unknown schema")
+	});
+	t.Run("nested routes", func (t *testing.T) {
+		var ctx interface{}
+		assert.NoError(t, setup_fn(t, &ctx))
+		defer func () {
+			assert.NoError(t, teardown_fn(t, &ctx))
+		}()
+
+		users := []map[string]interface{}{
+			{ "id": 1, "name": "John" },
+			{ "id": 2, "name": "Jimmy" },
+			{ "id": 3, "name": "Alex" },
+		}
+		users_schema := []*TestSchemaDefinition{
+			{ FieldName: "id", FieldType: TestSchemaFieldType_INT },
+			{ FieldName: "name", FieldType: TestSchemaFieldType_STRING },
+		}
+		orders := []map[string]interface{}{
+			{ "id": 10, "user_id": 1, "item": "book" },
+			{ "id": 11, "user_id": 1, "item": "pen" },
+			{ "id": 12, "user_id": 2, "item": "cup" },
+		}
+		orders_schema := []*TestSchemaDefinition{
+			{ FieldName: "id", FieldType: TestSchemaFieldType_INT },
+			{ FieldName: "user_id", FieldType: TestSchemaFieldType_INT },
+			{ FieldName: "item", FieldType: TestSchemaFieldType_STRING },
+		}
+
+		users_provider := data_provider_creator(t, users_schema, users, &ctx)
+		orders_provider := data_provider_creator(t, orders_schema, orders, &ctx)
+		assert.NotNil(t, users_provider, "Failed to create data provider")
+		assert.NotNil(t, orders_provider, "Failed to create data provider")
+		if users_provider == nil || orders_provider == nil {  return }
+
+		config := &Config{
+			Schemas: []*Schema{
+				{ 
+					Name: "Users",
+					Provider: users_provider,
+					Relations: []*Relation{
+						{ Name: "orders", Type: RelationType_ONE_TO_MANY, Schema: "Orders", Field: "id", ForeignField: "user_id" },
+					},
+				}, {
+					Name: "Orders",
+					Provider: orders_provider,
+					Relations: []*Relation{
+						{ Name: "user", Type: RelationType_MANY_TO_ONE, Schema: "Users", Field: "user_id", ForeignField: "id" },
+					},
+				},
+			},
+		}
+
+		res, err := EasyApiImpl(config);
+		assert.NoError(t, err, "Default config failed.")
+
+		items := func (res_opaque interface{}) []interface{} {
+			data, ok := res_opaque.(*[]map[string]interface{})
+			assert.True(t, ok)
+			found := []interface{}{}
+			if data == nil { return found }
+			for _, entry := range *data {
+				found = append(found, entry["item"])
+			}
+			return found
+		}
+
+		findone_route := GetRoute(res, "/api/users/{id}/orders/findone")
+		assert.NotNil(t, findone_route)
+		if findone_route == nil { return }
+		assert.Equal(t, []string{ "id" }, findone_route.PathParams)
+
+		res_opaque, err := findone_route.ActionWithPath(map[string]string{ "id": "2" }, "", nil)
+		assert.NoError(t, err)
+		entry, _ := res_opaque.(*map[string]interface{})
+		if entry == nil { return }
+		assert.Equal(t, "cup", (*entry)["item"])
+		// The implicit constraint cannot be escaped through the url parameters.
+		_, err = findone_route.ActionWithPath(map[string]string{ "id": "2" }, "item=\"-eq book\"", nil)
+		assert.Error(t, err)
+		_, err = findone_route.Action("")
+		assert.ErrorContains(t, err, "path parameter")
+
+		res_opaque, err = GetRoute(res, "/api/orders/{user_id}/user/findone").ActionWithPath(map[string]string{ "user_id": "1" }, "", nil)
+		assert.NoError(t, err)
+		entry, _ = res_opaque.(*map[string]interface{})
+		if entry == nil { return }
+		assert.Equal(t, "John", (*entry)["name"])
+
+		all_route := GetRoute(res, "/api/users/{id}/orders/all")
+		if orders_provider.Find == nil {
+			assert.Nil(t, all_route, "nested all route served without Find")
+			return
+		}
+		assert.NotNil(t, all_route)
+		if all_route == nil { return }
+
+		res_opaque, err = all_route.ActionWithPath(map[string]string{ "id": "1" }, "", nil)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []interface{}{ "book", "pen" }, items(res_opaque))
+		res_opaque, err = all_route.ActionWithPath(map[string]string{ "id": "3" }, "", nil)
+		assert.NoError(t, err)
+		assert.Empty(t, items(res_opaque))
+
+		bulk_route := GetRoute(res, "/api/users/{id}/orders/bulk")
+		if orders_provider.InsertMany == nil { return }
+		assert.NotNil(t, bulk_route)
+		if bulk_route == nil { return }
+
+		// Written entries get the value of the route.
+		_, err = bulk_route.ActionWithPath(map[string]string{ "id": "3" }, "", []byte(`[{"id": 13, "item": "mug"}]`))
+		assert.NoError(t, err)
+		res_opaque, err = all_route.ActionWithPath(map[string]string{ "id": "3" }, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ "mug" }, items(res_opaque))
+
+		_, err = bulk_route.ActionWithPath(map[string]string{ "id": "3" }, "", []byte(`[{"id": 14, "item": "lamp", "user_id": 2}]`))
+		var bulk_err *BulkInsertError
+		assert.ErrorAs(t, err, &bulk_err)
+	});
 }
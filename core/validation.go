@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var _uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+// Compile the patterns of the fields of `schema`.
+func compile_field_patterns (schema *Schema) error {
+	for _, f := range schema.Fields {
+		if len(f.Pattern) == 0 { continue }
+		pattern, err := regexp.Compile(f.Pattern)
+		if err != nil { return fmt.Errorf("invalid pattern of field \"%s\" in schema \"%s\": %w", f.Name, schema.Name, err) }
+		f._pattern = pattern
+	}
+	return nil
+}
+
+func (f *Field) pattern () (*regexp.Regexp, error) {
+	if f._pattern == nil { return regexp.Compile(f.Pattern) }
+	return f._pattern, nil
+}
+
+// Check a string value against the format of the field type.
+func check_string_format (value string, t FieldType) string {
+	switch t {
+	case FieldType_UUID:
+		if !_uuidPattern.MatchString(value) { return "must be a uuid" }
+	case FieldType_DATE:
+		if _, err := time.Parse(time.DateOnly, value); err != nil { return "must be a date (YYYY-MM-DD)" }
+	case FieldType_DATETIME:
+		_, err := time.Parse(time.DateTime, value)
+		if err != nil { _, err = time.Parse(time.RFC3339Nano, value) }
+		if err != nil { return "must be a datetime (RFC 3339)" }
+	case FieldType_BLOB:
+		if _, err := base64.StdEncoding.DecodeString(value); err != nil { return "must be base64 encoded" }
+	}
+	return ""
+}
+
+// Check a non-null value of the field, returning the violation or "".
+func (f *Field) check_value (value interface{}) string {
+	switch f.Type {
+	case FieldType_UNDEF, FieldType_JSON:
+		return ""
+	case FieldType_BOOL:
+		if _, ok := value.(bool); !ok { return "must be a boolean" }
+		return ""
+	case FieldType_INT, FieldType_FLOAT, FieldType_DECIMAL:
+		number, ok := as_number(value)
+		// Decimals may be sent as strings to keep their precision.
+		if s, is_string := value.(string); is_string && f.Type == FieldType_DECIMAL {
+			parsed, err := strconv.ParseFloat(s, 64)
+			number, ok = parsed, err == nil
+		}
+		if !ok { return "must be a number" }
+		if f.Type == FieldType_INT && number != math.Trunc(number) { return "must be an integer" }
+		if f.Min != nil && number < *f.Min { return fmt.Sprintf("must be at least %v", *f.Min) }
+		if f.Max != nil && number > *f.Max { return fmt.Sprintf("must be at most %v", *f.Max) }
+		return ""
+	}
+
+	s, ok := value.(string)
+	if !ok { return "must be a string" }
+	if msg := check_string_format(s, f.Type); len(msg) > 0 { return msg }
+	length := utf8.RuneCountInString(s)
+	if f.MinLength > 0 && length < f.MinLength { return fmt.Sprintf("must hold at least %d characters", f.MinLength) }
+	if f.MaxLength > 0 && length > f.MaxLength { return fmt.Sprintf("must hold at most %d characters", f.MaxLength) }
+	if len(f.Pattern) > 0 {
+		pattern, err := f.pattern()
+		if err != nil { return "invalid pattern" }
+		if !pattern.MatchString(s) { return fmt.Sprintf("must match \"%s\"", f.Pattern) }
+	}
+	if f.Type == FieldType_ENUM && len(f.Values) > 0 {
+		for _, v := range f.Values {
+			if v == s { return "" }
+		}
+		return fmt.Sprintf("must be one of: %s", strings.Join(f.Values, ", "))
+	}
+	return ""
+}
+
+// Check a written `entry` against the declared fields of `schema`. Every
+// violation is reported in the fields of the returned error. Schemas without
+// declared fields accept any entry.
+func validate_entry (entry map[string]interface{}, schema *Schema) *Error {
+	if len(schema.Fields) == 0 { return nil }
+	err := ValidationErrorf("invalid_entry", "entry does not match the fields of \"%s\"", schema.Name)
+
+	unknown := []string{}
+	for k := range entry {
+		if schema.Field(k) == nil { unknown = append(unknown, k) }
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		err.WithField(k, "unknown field")
+	}
+
+	for _, f := range schema.Fields {
+		value, exists := entry[f.Name]
+		if !exists {
+			if f.Required { err.WithField(f.Name, "required") }
+			continue
+		}
+		if value == nil {
+			if !f.Nullable { err.WithField(f.Name, "cannot be null") }
+			continue
+		}
+		if msg := f.check_value(value); len(msg) > 0 { err.WithField(f.Name, msg) }
+	}
+
+	if len(err.Fields) == 0 { return nil }
+	return err
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEntry (t *testing.T) {
+	min_age, max_age := 0.0, 150.0
+	schema := &Schema{
+		Name: "Users",
+		Fields: []*Field{
+			{ Name: "id", Type: FieldType_INT, PrimaryKey: true, Required: true },
+			{ Name: "name", Type: FieldType_STRING, Required: true, MinLength: 2, MaxLength: 8 },
+			{ Name: "age", Type: FieldType_INT, Nullable: true, Min: &min_age, Max: &max_age },
+			{ Name: "email", Type: FieldType_STRING, Nullable: true, Pattern: `^[^@\s]+@[^@\s]+$` },
+			{ Name: "role", Type: FieldType_ENUM, Values: []string{ "admin", "member" } },
+			{ Name: "balance", Type: FieldType_DECIMAL },
+			{ Name: "born", Type: FieldType_DATE },
+			{ Name: "token", Type: FieldType_UUID },
+			{ Name: "active", Type: FieldType_BOOL },
+			{ Name: "settings", Type: FieldType_JSON },
+		},
+	}
+	assert.NoError(t, compile_field_patterns(schema))
+
+	valid := map[string]interface{}{
+		"id": json.Number("1"),
+		"name": "Zoë",
+		"age": nil,
+		"email": "zoe@example.com",
+		"role": "admin",
+		"balance": "12.50",
+		"born": "1990-04-01",
+		"token": "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"active": true,
+		"settings": map[string]interface{}{ "theme": "dark" },
+	}
+	assert.Nil(t, validate_entry(valid, schema))
+
+	err := validate_entry(map[string]interface{}{
+		"id": json.Number("1.5"),
+		"age": json.Number("200"),
+		"email": "not an email",
+		"role": "owner",
+		"balance": "a lot",
+		"born": "01/04/1990",
+		"token": "abc",
+		"active": "yes",
+		"nickname": "Z",
+	}, schema)
+	assert.NotNil(t, err)
+	if err == nil { return }
+	assert.Equal(t, ErrorKind_VALIDATION, err.Kind)
+	assert.Equal(t, []*FieldError{
+		{ Field: "nickname", Message: "unknown field" },
+		{ Field: "id", Message: "must be an integer" },
+		{ Field: "name", Message: "required" },
+		{ Field: "age", Message: "must be at most 150" },
+		{ Field: "email", Message: "must match \"^[^@\\s]+@[^@\\s]+$\"" },
+		{ Field: "role", Message: "must be one of: admin, member" },
+		{ Field: "balance", Message: "must be a number" },
+		{ Field: "born", Message: "must be a date (YYYY-MM-DD)" },
+		{ Field: "token", Message: "must be a uuid" },
+		{ Field: "active", Message: "must be a boolean" },
+	}, err.Fields)
+
+	err = validate_entry(map[string]interface{}{ "id": 1, "name": "Z", "role": nil }, schema)
+	assert.NotNil(t, err)
+	if err == nil { return }
+	assert.Equal(t, []*FieldError{
+		{ Field: "name", Message: "must hold at least 2 characters" },
+		{ Field: "role", Message: "cannot be null" },
+	}, err.Fields)
+
+	// Schemas without declared fields accept any entry.
+	assert.Nil(t, validate_entry(map[string]interface{}{ "anything": 1 }, &Schema{ Name: "Logs" }))
+
+	_, config_err := EasyApiImpl(&Config{
+		Schemas: []*Schema{{
+			Name: "Users",
+			Provider: CreateMemoryDataProvider(nil),
+			Fields: []*Field{{ Name: "name", Type: FieldType_STRING, Pattern: "(" }},
+		}},
+	})
+	assert.ErrorContains(t, config_err, "invalid pattern")
+}
+
+func TestValidatedRoutes (t *testing.T) {
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{{
+			Name: "Users",
+			Provider: CreateMemoryDataProvider([]map[string]interface{}{}),
+			Fields: []*Field{
+				{ Name: "id", Type: FieldType_INT, PrimaryKey: true, Required: true },
+				{ Name: "name", Type: FieldType_STRING, Required: true },
+			},
+		}},
+	})
+	assert.NoError(t, err)
+
+	_, err = GetRoute(res, "/api/users/bulk").ActionWithBody("", []byte(`[{"id": 1, "name": "John"}, {"id": "2"}]`))
+	var bulk_err *BulkInsertError
+	assert.ErrorAs(t, err, &bulk_err)
+	if bulk_err == nil { return }
+	assert.Len(t, bulk_err.Errors, 1)
+	assert.Equal(t, 1, bulk_err.Errors[0].Index)
+	assert.Equal(t, []*FieldError{
+		{ Field: "id", Message: "must be a number" },
+		{ Field: "name", Message: "required" },
+	}, bulk_err.Errors[0].Fields)
+
+	_, err = GetRoute(res, "/api/users/upsert").ActionWithBody("", []byte(`{"id": 1, "name": 7}`))
+	problem := NewProblem(err)
+	assert.Equal(t, "invalid_entry", problem.Code)
+	assert.Equal(t, []*FieldError{{ Field: "name", Message: "must be a string" }}, problem.Errors)
+}
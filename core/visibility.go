@@ -0,0 +1,128 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type FieldVisibility int
+const (
+	// Served and written.
+	FieldVisibility_VISIBLE FieldVisibility = 0
+	// Neither served nor written, e.g. a password hash. Clients cannot tell
+	// the field from an unknown one.
+	FieldVisibility_HIDDEN FieldVisibility = 1
+	// Written but never served, e.g. a secret set by the client.
+	FieldVisibility_WRITE_ONLY FieldVisibility = 2
+	// Served but never written by clients, e.g. a creation date set by a hook.
+	FieldVisibility_READ_ONLY FieldVisibility = 3
+)
+
+// Masks the string representation of a served value.
+type FieldMask func(value string) string
+
+// Mask every character but the last `n`, e.g. "*****6789". Values of at
+// most `n` characters are masked entirely.
+func MaskKeepLast (n int) FieldMask {
+	return func (value string) string {
+		runes := []rune(value)
+		if len(runes) <= n { return strings.Repeat("*", len(runes)) }
+		return strings.Repeat("*", len(runes) - n) + string(runes[len(runes) - n:])
+	}
+}
+
+// Mask the whole value, without disclosing its length.
+func MaskAll (value string) string {
+	return "****"
+}
+
+func has_any_role (principal *Principal, roles []string) bool {
+	if principal == nil { return false }
+	for _, role := range principal.Roles {
+		if slices.Contains(roles, role) { return true }
+	}
+	return false
+}
+
+func (f *Field) allows_role (principal *Principal) bool {
+	return f.Roles == nil || has_any_role(principal, f.Roles)
+}
+
+// Whether the field is served to `principal`.
+func (f *Field) can_read (principal *Principal) bool {
+	if f.Visibility == FieldVisibility_HIDDEN || f.Visibility == FieldVisibility_WRITE_ONLY { return false }
+	return f.allows_role(principal)
+}
+
+// Whether `principal` may write the field.
+func (f *Field) can_write (principal *Principal) bool {
+	if f.Visibility == FieldVisibility_HIDDEN || f.Visibility == FieldVisibility_READ_ONLY { return false }
+	return f.allows_role(principal)
+}
+
+func (f *Field) is_masked (principal *Principal) bool {
+	return f.Mask != nil && !has_any_role(principal, f.UnmaskedRoles)
+}
+
+// Check that the client may filter, group or search on `fields`: filtering
+// on a field it cannot read unmasked would disclose its values.
+func (s *Schema) check_queried_fields (request *Request, fields []string) error {
+	for _, name := range fields {
+		f := s.Field(name)
+		if f == nil { continue }
+		if !f.can_read(request.Principal) {
+			return ValidationErrorf("unknown_field", "unknown field \"%s\"", name).WithField(name, "unknown field")
+		}
+		if f.is_masked(request.Principal) {
+			return ValidationErrorf("masked_field", "field \"%s\" is masked and cannot be queried", name).WithField(name, "masked")
+		}
+	}
+	return nil
+}
+
+func constraint_fields (constraints []Constraint) []string {
+	fields := []string{}
+	for _, c := range constraints {
+		fields = append(fields, c.Property)
+	}
+	return fields
+}
+
+// Check that the client may write the fields of `entry`, but `keys` which
+// identify the entry rather than write it, and are checked as queried fields.
+func (s *Schema) check_written_fields (request *Request, entry map[string]interface{}, keys []string) *Error {
+	err := ValidationErrorf("invalid_entry", "entry writes fields the client cannot write")
+	for _, f := range s.Fields {
+		if _, exists := entry[f.Name]; !exists || slices.Contains(keys, f.Name) { continue }
+		switch {
+		case f.Visibility == FieldVisibility_HIDDEN:
+			err.WithField(f.Name, "unknown field")
+		case !f.allows_role(request.Principal):
+			err.WithField(f.Name, "not allowed")
+		case !f.can_write(request.Principal):
+			err.WithField(f.Name, "read only")
+		}
+	}
+	if len(err.Fields) == 0 { return nil }
+	return err
+}
+
+// Remove the fields the client cannot read from `entries`, and mask the
+// others as required.
+func (s *Schema) redact_entries (request *Request, entries []map[string]interface{}) {
+	for _, f := range s.Fields {
+		readable := f.can_read(request.Principal)
+		masked := f.is_masked(request.Principal)
+		if readable && !masked { continue }
+		for _, entry := range entries {
+			value, exists := entry[f.Name]
+			if !exists { continue }
+			if !readable {
+				delete(entry, f.Name)
+			} else if value != nil {
+				entry[f.Name] = f.Mask(fmt.Sprint(value))
+			}
+		}
+	}
+}
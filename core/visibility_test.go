@@ -0,0 +1,135 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldMasks (t *testing.T) {
+	assert.Equal(t, "*****6789", MaskKeepLast(4)("123456789"))
+	assert.Equal(t, "***", MaskKeepLast(4)("123"))
+	assert.Equal(t, "****", MaskAll("a secret"))
+}
+
+func TestFieldVisibility (t *testing.T) {
+	// Authenticates the roles named by a header, as a token would.
+	authenticator := func (request *Request) (*Principal, error) {
+		return &Principal{ ID: "client", Roles: request.Headers.Values("X-Role") }, nil
+	}
+
+	users := &Schema{
+		Name: "Users",
+		Provider: CreateMemoryDataProvider([]map[string]interface{}{
+			{ "id": 1, "name": "alice", "password_hash": "5e88", "card": "4111111111111111", "salary": 100, "created_at": "2024-01-01" },
+			{ "id": 2, "name": "bob", "password_hash": "9f86", "card": "5500000000000004", "salary": 200, "created_at": "2024-02-01" },
+		}),
+		Fields: []*Field{
+			{ Name: "id", Type: FieldType_INT, PrimaryKey: true },
+			{ Name: "name", Type: FieldType_STRING, Searchable: true },
+			{ Name: "password_hash", Type: FieldType_STRING, Visibility: FieldVisibility_HIDDEN },
+			{ Name: "password", Type: FieldType_STRING, Visibility: FieldVisibility_WRITE_ONLY },
+			{ Name: "card", Type: FieldType_STRING, Searchable: true, Mask: MaskKeepLast(4), UnmaskedRoles: []string{ "billing" } },
+			{ Name: "salary", Type: FieldType_INT, Roles: []string{ "hr" } },
+			{ Name: "created_at", Type: FieldType_STRING, Visibility: FieldVisibility_READ_ONLY },
+		},
+	}
+	res, err := EasyApiImpl(&Config{
+		Schemas: []*Schema{ users },
+		Authenticators: []Authenticator{ authenticator },
+	})
+	assert.NoError(t, err)
+
+	run := func (route string, roles []string, params string, body string) (interface{}, error) {
+		parsed, err := parse_route_params(params)
+		assert.NoError(t, err)
+		request := &Request{ Params: parsed, Headers: http.Header{ "X-Role": roles } }
+		if len(body) > 0 { request.Body = []byte(body) }
+		return GetRoute(res, route).Handle(request)
+	}
+
+	t.Run("reads", func (t *testing.T) {
+		result, err := run("/api/users/all", nil, "", "")
+		assert.NoError(t, err)
+		entry := (*result.(*[]map[string]interface{}))[0]
+		assert.Equal(t, "alice", entry["name"])
+		assert.Equal(t, "************1111", entry["card"])
+		assert.NotContains(t, entry, "password_hash")
+		assert.NotContains(t, entry, "salary")
+		assert.Contains(t, entry, "created_at")
+
+		result, err = run("/api/users/findone", []string{ "billing", "hr" }, "id=-eq%202", "")
+		assert.NoError(t, err)
+		entry = *result.(*map[string]interface{})
+		assert.Equal(t, "5500000000000004", entry["card"])
+		assert.Equal(t, 200, entry["salary"])
+		assert.NotContains(t, entry, "password_hash")
+
+		// The stored entries are left untouched.
+		stored, err := users.Provider.FindOne([]Constraint{{ Property: "id", Value: "1", Comparison: Comparison_EQ }})
+		assert.NoError(t, err)
+		assert.Equal(t, "5e88", (*stored)["password_hash"])
+	});
+
+	t.Run("queries", func (t *testing.T) {
+		_, err := run("/api/users/findone", nil, "password_hash=-eq%205e88", "")
+		assert.Equal(t, "unknown_field", NewProblem(err).Code)
+		_, err = run("/api/users/findone", nil, "salary=-gt%20150", "")
+		assert.Equal(t, "unknown_field", NewProblem(err).Code)
+		_, err = run("/api/users/findone", []string{ "hr" }, "salary=-gt%20150", "")
+		assert.NoError(t, err)
+		_, err = run("/api/users/distinct", nil, "field=card", "")
+		assert.Equal(t, "masked_field", NewProblem(err).Code)
+		_, err = run("/api/users/distinct", []string{ "billing" }, "field=card", "")
+		assert.NoError(t, err)
+		_, err = run("/api/users/aggregate", nil, "metric=sum(salary)", "")
+		assert.Equal(t, ErrorKind_VALIDATION, KindOf(err))
+
+		// Masked fields are not searched.
+		result, err := run("/api/users/search", nil, "q=4111111111111111", "")
+		assert.NoError(t, err)
+		assert.Len(t, *result.(*[]map[string]interface{}), 0)
+		result, err = run("/api/users/search", []string{ "billing" }, "q=4111111111111111", "")
+		assert.NoError(t, err)
+		assert.Len(t, *result.(*[]map[string]interface{}), 1)
+	});
+
+	t.Run("writes", func (t *testing.T) {
+		_, err := run("/api/users/bulk", nil, "", `[{"id": 3, "name": "carol", "password": "hunter2"}]`)
+		assert.NoError(t, err)
+		result, err := run("/api/users/findone", nil, "id=-eq%203", "")
+		assert.NoError(t, err)
+		assert.NotContains(t, *result.(*map[string]interface{}), "password")
+
+		_, err = run("/api/users/bulk", nil, "", `[{"id": 4, "password_hash": "x", "created_at": "2024-03-01", "salary": 1}]`)
+		assert.Equal(t, ErrorKind_VALIDATION, KindOf(err))
+		bulk_err := err.(*BulkInsertError)
+		assert.Len(t, bulk_err.Errors, 1)
+		messages := map[string]string{}
+		for _, field := range bulk_err.Errors[0].Fields {
+			messages[field.Field] = field.Message
+		}
+		assert.Equal(t, map[string]string{
+			"password_hash": "unknown field",
+			"created_at": "read only",
+			"salary": "not allowed",
+		}, messages)
+
+		_, err = run("/api/users/upsert", []string{ "hr" }, "", `{"id": 1, "salary": 150}`)
+		assert.NoError(t, err)
+		_, err = run("/api/users/upsert", nil, "", `{"id": 1, "salary": 150}`)
+		assert.Equal(t, "invalid_entry", NewProblem(err).Code)
+
+		// Conflict keys would disclose whether an entry holds their value.
+		_, err = run("/api/users/upsert", nil, "key=password_hash", `{"password_hash": "5e88", "name": "eve"}`)
+		assert.Equal(t, "unknown_field", NewProblem(err).Code)
+		_, err = run("/api/users/upsert", nil, "key=salary", `{"salary": 100, "name": "eve"}`)
+		assert.Equal(t, "unknown_field", NewProblem(err).Code)
+		_, err = run("/api/users/upsert", nil, "key=card", `{"card": "4111111111111111", "name": "eve"}`)
+		assert.Equal(t, "masked_field", NewProblem(err).Code)
+		result, err = run("/api/users/upsert", []string{ "billing" }, "key=card", `{"card": "4111111111111111", "name": "alicia"}`)
+		assert.NoError(t, err)
+		assert.False(t, result.(*UpsertResult).Created)
+	});
+}
@@ -0,0 +1,279 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+)
+
+type HttpProviderConfig struct {
+	// URL template used for `All`. The placeholders `{offset}` and `{count}`
+	// are replaced with the requested bounds.
+	// e.g. "https://legacy.local/users?skip={offset}&limit={count}"
+	AllUrl string
+	// URL template used for `FindOne`. A `{<property>}` placeholder is replaced
+	// with the value of the `-eq` constraint on that property, and
+	// `{constraints}` is replaced with every constraint encoded as an easyapi
+	// query string (e.g. "name=-eq+John"). Without `{constraints}`, lookups on
+	// anything but the `-eq` of a placeholder are rejected.
+	// e.g. "https://legacy.local/users/{id}"
+	FindOneUrl string
+	// Dotted path to the result inside the upstream JSON response,
+	// e.g. "data.items" or "results.0". Empty means the whole response.
+	AllResultPath string
+	FindOneResultPath string
+	// Extra headers sent with every upstream request.
+	Headers map[string]string
+	// Timeout of a single upstream attempt.
+	// Default: 10 seconds
+	Timeout time.Duration
+	// Number of additional attempts after a network error or a 5xx/429 response.
+	Retries int
+	// Delay between attempts, doubled after every retry.
+	// Default: 100 milliseconds
+	RetryDelay time.Duration
+	// The client used to reach the upstream. If nil, a client with `Timeout` is used.
+	Client *http.Client
+}
+
+// Error returned when the upstream answered with a status that is not retried.
+type HttpStatusError struct {
+	Url string
+	StatusCode int
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("upstream \"%s\" responded with status %d", e.Url, e.StatusCode)
+}
+
+func is_retryable_status (status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// The names of the `{key}` placeholders of `template`.
+func url_template_placeholders (template string) ([]string, error) {
+	keys := []string{}
+	for {
+		start := strings.Index(template, "{")
+		if start < 0 { return keys, nil }
+		end := strings.Index(template[start:], "}")
+		if end < 0 { return nil, fmt.Errorf("unterminated placeholder in url template \"%s\"", template) }
+		keys = append(keys, template[start+1:start+end])
+		template = template[start+end+1:]
+	}
+}
+
+// Replace every `{key}` placeholder in `template` with the url escaped value.
+func expand_url_template (template string, values map[string]string) (string, error) {
+	var out strings.Builder
+	for {
+		start := strings.Index(template, "{")
+		if start < 0 { break }
+		end := strings.Index(template[start:], "}")
+		if end < 0 { return "", fmt.Errorf("unterminated placeholder in url template \"%s\"", template) }
+		end += start
+
+		key := template[start+1:end]
+		value, ok := values[key]
+		if !ok { return "", core.ValidationErrorf("missing_constraint", "no value available for url template placeholder \"{%s}\"", key) }
+
+		out.WriteString(template[:start])
+		out.WriteString(value)
+		template = template[end+1:]
+	}
+	out.WriteString(template)
+	return out.String(), nil
+}
+
+func constraints_to_template_values (constraints []core.Constraint) map[string]string {
+	values := map[string]string{}
+	query := url.Values{}
+	for _, c := range constraints {
+		if c.Comparison == core.Comparison_EQ {
+			values[c.Property] = url.PathEscape(c.Value)
+		}
+		if c.Comparison.IsUnary() {
+			query.Add(c.Property, fmt.Sprintf("-%s", c.Comparison))
+		} else if c.Comparison == core.Comparison_IN {
+			query.Add(c.Property, fmt.Sprintf("-%s %s", c.Comparison, strings.Join(c.Values, ",")))
+		} else {
+			query.Add(c.Property, fmt.Sprintf("-%s %s", c.Comparison, c.Value))
+		}
+	}
+	values["constraints"] = query.Encode()
+	return values
+}
+
+// Check that the upstream receives every constraint, through the
+// `{constraints}` placeholder of `template` or the placeholder of its property.
+func check_forwarded_constraints (template string, constraints []core.Constraint) error {
+	if strings.Contains(template, "{constraints}") { return nil }
+	seen := map[string]bool{}
+	for _, c := range constraints {
+		if c.Comparison != core.Comparison_EQ || seen[c.Property] || !strings.Contains(template, "{" + c.Property + "}") {
+			return core.ValidationErrorf("unsupported_constraint", "the upstream cannot filter \"%s\" with -%s", c.Property, c.Comparison)
+		}
+		seen[c.Property] = true
+	}
+	return nil
+}
+
+// Walk the decoded json `value` along the dotted `json_path`.
+func extract_json_path (value interface{}, json_path string) (interface{}, error) {
+	if len(json_path) == 0 { return value, nil }
+	for _, key := range strings.Split(json_path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok { return nil, core.UnavailableError(fmt.Errorf("json path \"%s\": key \"%s\" not found", json_path, key)) }
+			value = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, core.UnavailableError(fmt.Errorf("json path \"%s\": invalid array index \"%s\"", json_path, key))
+			}
+			value = node[index]
+		default:
+			return nil, core.UnavailableError(fmt.Errorf("json path \"%s\": cannot descend into \"%s\"", json_path, key))
+		}
+	}
+	return value, nil
+}
+
+func to_entry (value interface{}) (map[string]interface{}, error) {
+	entry, ok := value.(map[string]interface{})
+	if !ok { return nil, core.UnavailableError(fmt.Errorf("expected upstream entry to be a json object, received %T", value)) }
+	return entry, nil
+}
+
+type http_provider struct {
+	config *HttpProviderConfig
+	client *http.Client
+}
+
+func (p *http_provider) get (target string) (interface{}, error) {
+	delay := p.config.RetryDelay
+	var last_err error
+	for attempt := 0; attempt <= p.config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil { return nil, err }
+		req.Header.Set("Accept", "application/json")
+		for k, v := range p.config.Headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			last_err = err
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			last_err = err
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			last_err = &HttpStatusError{ Url: target, StatusCode: resp.StatusCode }
+			if is_retryable_status(resp.StatusCode) { continue }
+			if resp.StatusCode == http.StatusNotFound {
+				return nil, core.NotFoundErrorf("not_found", "upstream returned %d: %w", resp.StatusCode, last_err)
+			}
+			return nil, last_err
+		}
+
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			return nil, core.UnavailableError(fmt.Errorf("failed to decode upstream response from \"%s\": %w", target, err))
+		}
+		return decoded, nil
+	}
+	// Network errors and retryable statuses until the last attempt.
+	return nil, core.UnavailableError(last_err)
+}
+
+// Create a data provider that forwards requests to an upstream HTTP service.
+func CreateHttpDataProvider (config *HttpProviderConfig) (*core.DataProvider, error) {
+	if config == nil { return nil, fmt.Errorf("http provider config cannot be nil") }
+	if len(config.AllUrl) == 0 && len(config.FindOneUrl) == 0 {
+		return nil, fmt.Errorf("at least one of AllUrl or FindOneUrl must be set")
+	}
+
+	cfg := *config
+	if cfg.Timeout <= 0 { cfg.Timeout = 10 * time.Second }
+	if cfg.RetryDelay <= 0 { cfg.RetryDelay = 100 * time.Millisecond }
+	if cfg.Retries < 0 { return nil, fmt.Errorf("retries cannot be negative, received %d", cfg.Retries) }
+	// Only the placeholders of constraints depend on the request.
+	all_keys, err := url_template_placeholders(cfg.AllUrl)
+	if err != nil { return nil, err }
+	for _, key := range all_keys {
+		if key != "offset" && key != "count" { return nil, fmt.Errorf("unknown placeholder \"{%s}\" in AllUrl", key) }
+	}
+	if _, err := url_template_placeholders(cfg.FindOneUrl); err != nil { return nil, err }
+
+	p := &http_provider{ config: &cfg, client: cfg.Client }
+	if p.client == nil {
+		p.client = &http.Client{ Timeout: cfg.Timeout }
+	}
+
+	return &core.DataProvider{
+		All: func(offset int, count int) ([]map[string]interface{}, error) {
+			if len(cfg.AllUrl) == 0 { return nil, fmt.Errorf("http provider has no AllUrl configured") }
+
+			target, err := expand_url_template(cfg.AllUrl, map[string]string{
+				"offset": strconv.Itoa(offset),
+				"count": strconv.Itoa(count),
+			})
+			if err != nil { return nil, err }
+
+			decoded, err := p.get(target)
+			if err != nil { return nil, err }
+			result, err := extract_json_path(decoded, cfg.AllResultPath)
+			if err != nil { return nil, err }
+
+			list, ok := result.([]interface{})
+			if !ok { return nil, core.UnavailableError(fmt.Errorf("expected upstream result to be a json array, received %T", result)) }
+
+			entries := []map[string]interface{}{}
+			for _, el := range list {
+				entry, err := to_entry(el)
+				if err != nil { return nil, err }
+				entries = append(entries, entry)
+			}
+			return entries, nil
+		},
+		FindOne: func(constraints []core.Constraint) (*map[string]interface{}, error) {
+			if len(cfg.FindOneUrl) == 0 { return nil, fmt.Errorf("http provider has no FindOneUrl configured") }
+
+			if err := check_forwarded_constraints(cfg.FindOneUrl, constraints); err != nil { return nil, err }
+			target, err := expand_url_template(cfg.FindOneUrl, constraints_to_template_values(constraints))
+			if err != nil { return nil, err }
+
+			decoded, err := p.get(target)
+			if err != nil { return nil, err }
+			result, err := extract_json_path(decoded, cfg.FindOneResultPath)
+			if err != nil { return nil, err }
+
+			if list, ok := result.([]interface{}); ok {
+				if len(list) == 0 { return nil, core.NotFoundErrorf("not_found", "no entries found") }
+				result = list[0]
+			}
+			entry, err := to_entry(result)
+			if err != nil { return nil, err }
+			return &entry, nil
+		},
+	}, nil
+}
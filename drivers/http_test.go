@@ -0,0 +1,275 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+type HttpTestUnitContext struct {
+	// The upstream servers started by the data provider creator.
+	Servers []*httptest.Server
+}
+
+// Serve `payload` the way a legacy REST service would:
+// GET /users?skip=&limit= returns { "data": { "items": [...] } }
+// GET /users/find?name=-eq+John returns { "results": [...] }
+func create_upstream_handler (payload []map[string]interface{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", func (w http.ResponseWriter, r *http.Request) {
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		end := min(skip + limit, len(payload))
+		if skip > end { skip = end }
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{ "items": payload[skip:end] },
+		})
+	})
+	mux.HandleFunc("/users/find", func (w http.ResponseWriter, r *http.Request) {
+		results := []map[string]interface{}{}
+		for _, entry := range payload {
+			matches := true
+			for key, values := range r.URL.Query() {
+				value := entry[key]
+				switch {
+				case values[0] == "-null":
+					matches = matches && value == nil
+				case values[0] == "-notnull":
+					matches = matches && value != nil
+				case strings.HasPrefix(values[0], "-ne "):
+					matches = matches && (value == nil || fmt.Sprint(value) != strings.TrimPrefix(values[0], "-ne "))
+				default:
+					matches = matches && value != nil && fmt.Sprint(value) == strings.TrimPrefix(values[0], "-eq ")
+				}
+			}
+			if matches { results = append(results, entry) }
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{ "results": results })
+	})
+	return mux
+}
+
+func TestHttpDataProvider (t *testing.T) {
+	core.SetupDataProviderTests(
+		t,
+		func (t *testing.T, ctx *interface{}) error {
+			*ctx = &HttpTestUnitContext{}
+			return nil
+		},
+		func (t *testing.T, ctx *interface{}) error {
+			http_ctx, ok := (*ctx).(*HttpTestUnitContext)
+			if !ok { return fmt.Errorf("data provider test context is not defined") }
+			for _, server := range http_ctx.Servers {
+				server.Close()
+			}
+			return nil
+		},
+		func (
+			t *testing.T,
+			schema []*core.TestSchemaDefinition,
+			payload []map[string]interface{},
+			opaq *interface{}) *core.DataProvider {
+				http_ctx, ok := (*opaq).(*HttpTestUnitContext)
+				assert.True(t, ok, "http context not provided")
+
+				server := httptest.NewServer(create_upstream_handler(payload))
+				http_ctx.Servers = append(http_ctx.Servers, server)
+				provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+					AllUrl: server.URL + "/users?skip={offset}&limit={count}",
+					AllResultPath: "data.items",
+					FindOneUrl: server.URL + "/users/find?{constraints}",
+					FindOneResultPath: "results",
+				})
+				assert.NoError(t, err)
+				return provider
+	})
+}
+
+func TestHttpDataProviderTransport (t *testing.T) {
+	t.Run("path placeholder", func (t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/users/42", r.URL.Path)
+			w.Write([]byte(`{ "user": { "id": 42, "name": "Alex" } }`))
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+			FindOneUrl: server.URL + "/users/{id}",
+			FindOneResultPath: "user",
+		})
+		assert.NoError(t, err)
+
+		entry, err := provider.FindOne([]core.Constraint{
+			{ Property: "id", Value: "42", Comparison: core.Comparison_EQ },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Alex", (*entry)["name"])
+
+		// Constraints the upstream does not receive are rejected.
+		_, err = provider.FindOne([]core.Constraint{
+			{ Property: "id", Value: "42", Comparison: core.Comparison_EQ },
+			{ Property: "name", Value: "Bob", Comparison: core.Comparison_EQ },
+		})
+		assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+		assert.Equal(t, "unsupported_constraint", core.NewProblem(err).Code)
+		_, err = provider.FindOne([]core.Constraint{
+			{ Property: "id", Value: "42", Comparison: core.Comparison_GT },
+		})
+		assert.Equal(t, "unsupported_constraint", core.NewProblem(err).Code)
+		_, err = provider.FindOne(nil)
+		assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+		assert.Equal(t, "missing_constraint", core.NewProblem(err).Code)
+	});
+
+	t.Run("retries on server errors", func (t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`[{ "name": "Alex" }]`))
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+			AllUrl: server.URL,
+			Retries: 2,
+			RetryDelay: time.Millisecond,
+		})
+		assert.NoError(t, err)
+
+		entries, err := provider.All(0, 10)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	});
+
+	t.Run("gives up after retries", func (t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+			AllUrl: server.URL,
+			Retries: 1,
+			RetryDelay: time.Millisecond,
+		})
+		assert.NoError(t, err)
+
+		_, err = provider.All(0, 10)
+		var status_err *HttpStatusError
+		assert.ErrorAs(t, err, &status_err)
+		assert.Equal(t, http.StatusBadGateway, status_err.StatusCode)
+		assert.Equal(t, core.ErrorKind_UNAVAILABLE, core.KindOf(err))
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	});
+
+	t.Run("client errors are not retried", func (t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+			AllUrl: server.URL,
+			Retries: 3,
+			RetryDelay: time.Millisecond,
+		})
+		assert.NoError(t, err)
+
+		_, err = provider.All(0, 10)
+		assert.Equal(t, core.ErrorKind_NOT_FOUND, core.KindOf(err))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	});
+
+	t.Run("timeout", func (t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`[]`))
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+			AllUrl: server.URL,
+			Timeout: 20 * time.Millisecond,
+		})
+		assert.NoError(t, err)
+
+		_, err = provider.All(0, 10)
+		assert.Error(t, err)
+	});
+
+	t.Run("invalid json", func (t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<html>maintenance</html>`))
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{ AllUrl: server.URL })
+		assert.NoError(t, err)
+
+		_, err = provider.All(0, 10)
+		assert.Equal(t, core.ErrorKind_UNAVAILABLE, core.KindOf(err))
+	});
+
+	t.Run("invalid result path", func (t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{ "data": [] }`))
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{
+			AllUrl: server.URL,
+			AllResultPath: "data.items",
+		})
+		assert.NoError(t, err)
+
+		_, err = provider.All(0, 10)
+		assert.ErrorContains(t, err, "json path")
+		assert.Equal(t, core.ErrorKind_UNAVAILABLE, core.KindOf(err))
+	});
+
+	t.Run("unexpected result", func (t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func (w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{ "data": "maintenance" }`))
+		}))
+		defer server.Close()
+
+		provider, err := CreateHttpDataProvider(&HttpProviderConfig{ AllUrl: server.URL })
+		assert.NoError(t, err)
+
+		_, err = provider.All(0, 10)
+		assert.ErrorContains(t, err, "json array")
+		assert.Equal(t, core.ErrorKind_UNAVAILABLE, core.KindOf(err))
+
+		provider, err = CreateHttpDataProvider(&HttpProviderConfig{ FindOneUrl: server.URL + "?{constraints}", FindOneResultPath: "data" })
+		assert.NoError(t, err)
+		_, err = provider.FindOne(nil)
+		assert.ErrorContains(t, err, "json object")
+		assert.Equal(t, core.ErrorKind_UNAVAILABLE, core.KindOf(err))
+	});
+
+	t.Run("invalid url templates", func (t *testing.T) {
+		_, err := CreateHttpDataProvider(&HttpProviderConfig{ AllUrl: "https://legacy.local/users?skip={offset" })
+		assert.ErrorContains(t, err, "unterminated placeholder")
+		_, err = CreateHttpDataProvider(&HttpProviderConfig{ AllUrl: "https://legacy.local/users/{id}" })
+		assert.ErrorContains(t, err, "unknown placeholder")
+		_, err = CreateHttpDataProvider(&HttpProviderConfig{ FindOneUrl: "https://legacy.local/users/{id" })
+		assert.ErrorContains(t, err, "unterminated placeholder")
+	});
+}
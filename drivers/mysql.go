@@ -1,12 +1,11 @@
 package drivers
 
 import (
-	"encoding/binary"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/00startupkit/easyapi.go/core"
-	// _ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -15,57 +14,105 @@ const (
 	ColType_UNDEF ColType = 0
 	ColType_INT ColType = 1
 	ColType_STRING ColType = 2
+	ColType_FLOAT ColType = 3
+	// Served as a `json.Number` to keep the exact precision.
+	ColType_DECIMAL ColType = 4
+	ColType_BOOL ColType = 5
+	// Served as "YYYY-MM-DD".
+	ColType_DATE ColType = 6
+	ColType_DATETIME ColType = 7
+	ColType_TIMESTAMP ColType = 8
+	ColType_JSON ColType = 9
+	// Served base64 encoded.
+	ColType_BLOB ColType = 10
+	// CHAR(36) or BINARY(16) (see `Column.Binary`), served as
+	// "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx".
+	ColType_UUID ColType = 11
+	ColType_ENUM ColType = 12
 )
 
 type Column struct {
 	Type ColType
 	Name string
+	// Allowed values of an ENUM column. If empty, any value is accepted.
+	Values []string
+	// Whether the column may hold NULL, which is served as a json null.
+	Nullable bool
+	// Whether the column is part of the table's primary key.
+	PrimaryKey bool
+	// Whether a UUID column stores the 16 raw bytes (BINARY(16)) rather than
+	// the text form (CHAR(36)).
+	Binary bool
+}
+
+func quote_identifier (name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
 }
 
 func column_field_names (columns []Column) []string {
 	column_names := []string {}
 	for _, c := range columns {
-		column_names = append(column_names, c.Name)
+		column_names = append(column_names, quote_identifier(c.Name))
 	}
 	return column_names
 }
 
-func constraint_comparison_to_sql (comparison core.Comparison) string {
+func invalid_value_error (property string, err error) error {
+	return core.ValidationErrorf("invalid_value", "invalid value for \"%s\": %w", property, err).WithField(property, err.Error())
+}
+
+func constraint_comparison_to_sql (comparison core.Comparison) (string, error) {
 	switch comparison {
 		case core.Comparison_EQ:
-			return "=" 
+			return "=", nil
 		case core.Comparison_LT:
-			return "<" 
+			return "<", nil
 		case core.Comparison_LE:
-			return "<=" 
+			return "<=", nil
 		case core.Comparison_GT:
-			return ">" 
+			return ">", nil
 		case core.Comparison_GE:
-			return ">=" 
+			return ">=", nil
 	}
-	return "???"
+	return "", core.ValidationErrorf("invalid_constraint", "unsupported comparison: \"%s\"", comparison)
 }
 
-func wrap_based_on_column_type (value string, column Column) string {
-	switch column.Type {
-	case ColType_INT:
-		return value;
-	case ColType_STRING:
-		return fmt.Sprintf("\"%s\"", value)
+func constraint_to_sql_clause (constraint core.Constraint, column Column) (string, []interface{}, error) {
+	property := quote_identifier(constraint.Property)
+	switch constraint.Comparison {
+	case core.Comparison_NULL:
+		return fmt.Sprintf("%s IS NULL", property), nil, nil
+	case core.Comparison_NOTNULL:
+		return fmt.Sprintf("%s IS NOT NULL", property), nil, nil
+	case core.Comparison_IN:
+		if len(constraint.Values) == 0 { return "FALSE", nil, nil }
+		args := []interface{}{}
+		for _, value := range constraint.Values {
+			arg, err := encode_column_value(value, column)
+			if err != nil { return "", nil, invalid_value_error(constraint.Property, err) }
+			args = append(args, arg)
+		}
+		return fmt.Sprintf("%s IN (?%s)", property, strings.Repeat(",?", len(args) - 1)), args, nil
 	}
-	return "???"
-}
 
-func constraint_to_sql_clause (constraint core.Constraint, column Column) string {
-	return fmt.Sprintf(
-		"%s %s %s",
-		constraint.Property,
-		constraint_comparison_to_sql(constraint.Comparison),
-		wrap_based_on_column_type(constraint.Value, column))
+	arg, err := encode_column_value(constraint.Value, column)
+	if err != nil { return "", nil, invalid_value_error(constraint.Property, err) }
+
+	// Use the null-safe comparison so that NULL values are "not equal" to any value.
+	if constraint.Comparison == core.Comparison_NE {
+		return fmt.Sprintf("NOT (%s <=> ?)", property), []interface{}{ arg }, nil
+	}
+
+	operator, err := constraint_comparison_to_sql(constraint.Comparison)
+	if err != nil { return "", nil, err }
+	return fmt.Sprintf("%s %s ?", property, operator), []interface{}{ arg }, nil
 }
 
-func constraints_to_sql_clauses (constraints []core.Constraint, columns []Column) []string {
+// Convert the constraints into sql clauses with placeholders, and the
+// arguments bound to them.
+func constraints_to_sql_clauses (constraints []core.Constraint, columns []Column) ([]string, []interface{}, error) {
 	clauses := []string{}
+	args := []interface{}{}
 	for _, c := range constraints {
 		var column Column
 		found := false
@@ -76,11 +123,15 @@ func constraints_to_sql_clauses (constraints []core.Constraint, columns []Column
 				break
 			}
 		}
-		if !found { continue } // skip constraint if the propoerty is not found.
+		// Skipping the constraint would serve the entries it filters out.
+		if !found { return nil, nil, core.ValidationErrorf("unknown_field", "unknown field \"%s\"", c.Property).WithField(c.Property, "unknown field") }
 
-		clauses = append(clauses, constraint_to_sql_clause(c, column))
+		clause, clause_args, err := constraint_to_sql_clause(c, column)
+		if err != nil { return nil, nil, err }
+		clauses = append(clauses, clause)
+		args = append(args, clause_args...)
 	}
-	return clauses
+	return clauses, args, nil
 }
 
 func fix_payload_types (payload map[string]interface{}, columns []Column) (map[string]interface{}, error) {
@@ -98,91 +149,208 @@ func fix_payload_types (payload map[string]interface{}, columns []Column) (map[s
 			}
 		}
 
-		if !found { return nil, fmt.Errorf(fmt.Sprintf("could not find column definition for field \"%s\" in the payload", k)) }
+		if !found { return nil, fmt.Errorf("could not find column definition for field \"%s\" in the payload", k) }
 
-		bytearr, is_bytearr := v.([]byte)
-		if !is_bytearr { return nil, fmt.Errorf("parsed payload is not a byte array") }
-
-		switch column.Type {
-		case ColType_INT:
-			// Parse as int
-			fixed_payload[k] = binary.BigEndian.Uint64(bytearr)
-		case ColType_STRING:
-			// Parse as string
-			fixed_payload[k] = string(bytearr)
-		default:
-			return nil, fmt.Errorf(fmt.Sprintf("fix_payload_types unimplemented for type: %d", column.Type))
+		if v == nil {
+			if !column.Nullable { return nil, fmt.Errorf("column \"%s\" is not nullable but holds a NULL value", k) }
+			fixed_payload[k] = nil
+			continue
 		}
+
+		value, err := decode_column_value(v, column)
+		if err != nil { return nil, err }
+		fixed_payload[k] = value
 	}
 	return fixed_payload, nil
 }
 
-// TODO: Instead of passing the table name and having to create a new connection
-// for every request, implement some type of database pooling.
+// Read the entries selected by `query`. The entries are only returned once
+// every row is read, so that a read retried on another node starts over.
+func mysql_select (db *sqlx.DB, columns []Column, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Queryx(query, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	entries := []map[string]interface{}{}
+	for rows.Next() {
+		entry := make(map[string]interface{})
+		if err := rows.MapScan(entry); err != nil { return nil, err }
+		entry, err = fix_payload_types(entry, columns)
+		if err != nil { return nil, err }
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil { return nil, err }
+	return entries, nil
+}
+
 func CreateMysqlDataProvider (
-	user, password, database_name, table_name string,
+	config *MysqlConfig,
+	table_name string,
 	columns []Column,
 ) (*core.DataProvider, error) {
 
+	cluster, err := create_mysql_cluster(config)
+	if err != nil { return nil, err }
+	return create_mysql_data_provider(cluster, table_name, columns), nil
+}
+
+func create_mysql_data_provider (
+	cluster *mysql_cluster,
+	table_name string,
+	columns []Column,
+) *core.DataProvider {
+	table := quote_identifier(table_name)
+	// Whether a FULLTEXT index covers the searched fields, by searched fields.
+	var fulltext sync.Map
+
 	return &core.DataProvider{
 		All: func(offset int, count int) ([]map[string]interface{}, error) {
-			db, err := sqlx.Connect("mysql", fmt.Sprintf("%s:%s@/%s", user, password, database_name))
-			if err != nil { return nil, err }
-			defer db.Close()
-
 			query := fmt.Sprintf(
 				`SELECT %s FROM %s LIMIT %d OFFSET %d`,
 				strings.Join(column_field_names(columns), ","),
-				table_name,
+				table,
 				count,
 				offset,
 			)
 
-			rows, err := db.Queryx(query)
+			var entries []map[string]interface{}
+			err := cluster.read(func (db *sqlx.DB) error {
+				var err error
+				entries, err = mysql_select(db, columns, query)
+				return err
+			})
 			if err != nil { return nil, err }
-			defer rows.Close()
-
-			entries := []map[string]interface{}{}
-			for rows.Next() {
-				entry := make(map[string]interface{})
-				err = rows.MapScan(entry)
-				if err != nil { return nil, err }
-
-				entries = append(entries, entry)
-			}
 			return entries, nil
 		},
 		FindOne: func(constraints []core.Constraint) (*map[string]interface{}, error) {
-			db, err := sqlx.Connect("mysql", fmt.Sprintf("%s:%s@/%s", user, password, database_name))
+			clauses, args, err := constraints_to_sql_clauses(constraints, columns)
 			if err != nil { return nil, err }
-			defer db.Close()
 
 			query := fmt.Sprintf(
 				`SELECT %s FROM %s %s %s LIMIT 1`,
 				strings.Join(column_field_names(columns), ","),
-				table_name,
-				func () string { if len(constraints) == 0 { return "" } else { return "WHERE" } }(),
-				strings.Join(constraints_to_sql_clauses(constraints, columns), " AND "),
+				table,
+				func () string { if len(clauses) == 0 { return "" } else { return "WHERE" } }(),
+				strings.Join(clauses, " AND "),
 			)
 
-			fmt.Printf("Query: %s\n", query)
+			var found *map[string]interface{}
+			err = cluster.read(func (db *sqlx.DB) error {
+				rows, err := db.Queryx(query, args...)
+				if err != nil { return err }
+				defer rows.Close()
 
-			rows, err := db.Queryx(query)
-			defer rows.Close()
+				for rows.Next() {
+					entry := make(map[string]interface{})
+					err = rows.MapScan(entry)
+					if err != nil { return err }
 
-			for rows.Next() {
-				entry := make(map[string]interface{})
-				err = rows.MapScan(entry)
-				if err != nil { return nil, err }
+					entry, err = fix_payload_types(entry, columns)
+					if err != nil { return err }
 
-				entry, err = fix_payload_types(entry, columns)
-				if err != nil { return nil, err }
+					found = &entry
+					return nil
+				}
+				return rows.Err()
+			})
+			if err != nil { return nil, err }
+			if found == nil { return nil, core.NotFoundErrorf("not_found", "no entries found") }
+			return found, nil
+		},
+		Find: func(constraints []core.Constraint, offset int, count int) ([]map[string]interface{}, error) {
+			clauses, args, err := constraints_to_sql_clauses(constraints, columns)
+			if err != nil { return nil, err }
 
-				return &entry, nil
-			}
-			return nil, fmt.Errorf("no entries found")
+			query := fmt.Sprintf(
+				`SELECT %s FROM %s %s %s LIMIT %d OFFSET %d`,
+				strings.Join(column_field_names(columns), ","),
+				table,
+				func () string { if len(clauses) == 0 { return "" } else { return "WHERE" } }(),
+				strings.Join(clauses, " AND "),
+				count,
+				offset,
+			)
+
+			var entries []map[string]interface{}
+			err = cluster.read(func (db *sqlx.DB) error {
+				var err error
+				entries, err = mysql_select(db, columns, query, args...)
+				return err
+			})
+			if err != nil { return nil, err }
+			return entries, nil
 		},
-	}, nil
+		InsertMany: func(entries []map[string]interface{}) (int, error) {
+			var inserted int
+			err := cluster.write(func (db *sqlx.DB) error {
+				var err error
+				inserted, err = mysql_insert_many(db, table_name, columns, entries)
+				return err
+			})
+			return inserted, err
+		},
+		Upsert: func(entry map[string]interface{}, keys []string) (bool, error) {
+			var created bool
+			err := cluster.write(func (db *sqlx.DB) error {
+				var err error
+				created, err = mysql_upsert(db, table_name, columns, entry, keys)
+				return err
+			})
+			return created, err
+		},
+		Delete: func(constraints []core.Constraint) (int, error) {
+			clauses, args, err := constraints_to_sql_clauses(constraints, columns)
+			if err != nil { return 0, err }
+			if len(clauses) == 0 { return 0, core.ValidationErrorf("missing_constraints", "delete requires at least one constraint") }
+
+			query := fmt.Sprintf(`DELETE FROM %s WHERE %s`, table, strings.Join(clauses, " AND "))
+			var deleted int64
+			err = cluster.write(func (db *sqlx.DB) error {
+				res, err := db.Exec(query, args...)
+				if err != nil { return err }
+				deleted, err = res.RowsAffected()
+				return err
+			})
+			return int(deleted), err
+		},
+		Aggregate: func(query *core.AggregateQuery) ([]map[string]interface{}, error) {
+			var rows []map[string]interface{}
+			err := cluster.read(func (db *sqlx.DB) error {
+				var err error
+				rows, err = mysql_aggregate(db, table_name, columns, query)
+				return err
+			})
+			if err != nil { return nil, err }
+			return rows, nil
+		},
+		Search: func(query *core.SearchQuery) ([]map[string]interface{}, error) {
+			var entries []map[string]interface{}
+			err := cluster.read(func (db *sqlx.DB) error {
+				key := strings.Join(query.Fields, ",")
+				indexed, checked := fulltext.Load(key)
+				if !checked {
+					indexes, err := mysql_fulltext_indexes(db, table_name)
+					if err != nil { return err }
+					indexed = has_index(indexes, query.Fields)
+					fulltext.Store(key, indexed)
+				}
 
-	// return nil, fmt.Errorf("mysql data provider unimpl")
+				var err error
+				entries, err = mysql_search(db, table_name, columns, query, indexed.(bool))
+				return err
+			})
+			if err != nil { return nil, err }
+			return entries, nil
+		},
+		Distinct: func(field string, constraints []core.Constraint, limit int) ([]*core.DistinctValue, error) {
+			var values []*core.DistinctValue
+			err := cluster.read(func (db *sqlx.DB) error {
+				var err error
+				values, err = mysql_distinct(db, table_name, columns, field, constraints, limit)
+				return err
+			})
+			if err != nil { return nil, err }
+			return values, nil
+		},
+	}
 }
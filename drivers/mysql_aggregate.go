@@ -0,0 +1,150 @@
+package drivers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/jmoiron/sqlx"
+)
+
+func find_column (columns []Column, name string) (Column, error) {
+	for _, c := range columns {
+		if c.Name == name { return c, nil }
+	}
+	return Column{}, core.ValidationErrorf("unknown_field", "unknown field \"%s\"", name).WithField(name, "unknown field")
+}
+
+func aggregate_function_to_sql (function core.AggregateFunction) (string, error) {
+	switch function {
+	case core.AggregateFunction_COUNT: return "COUNT", nil
+	case core.AggregateFunction_SUM: return "SUM", nil
+	case core.AggregateFunction_AVG: return "AVG", nil
+	case core.AggregateFunction_MIN: return "MIN", nil
+	case core.AggregateFunction_MAX: return "MAX", nil
+	}
+	return "", core.ValidationErrorf("invalid_metric", "unknown aggregate function \"%s\"", function).WithField("metrics", "unknown aggregate function")
+}
+
+// Build the GROUP BY query computing `query` over `table`. Each metric is
+// aliased after its name so that rows come back keyed like the in-memory
+// provider's.
+func aggregate_query_to_sql (table string, columns []Column, query *core.AggregateQuery) (string, []interface{}, error) {
+	selected := []string{}
+	grouped := []string{}
+	for _, name := range query.GroupBy {
+		column, err := find_column(columns, name)
+		if err != nil { return "", nil, err }
+		grouped = append(grouped, quote_identifier(column.Name))
+	}
+	selected = append(selected, grouped...)
+
+	for _, metric := range query.Metrics {
+		function, err := aggregate_function_to_sql(metric.Function)
+		if err != nil { return "", nil, err }
+		argument := "*"
+		if metric.Field != "*" {
+			column, err := find_column(columns, metric.Field)
+			if err != nil { return "", nil, err }
+			argument = quote_identifier(column.Name)
+		}
+		selected = append(selected, fmt.Sprintf("%s(%s) AS %s", function, argument, quote_identifier(metric.Name())))
+	}
+
+	clauses, args, err := constraints_to_sql_clauses(query.Constraints, columns)
+	if err != nil { return "", nil, err }
+
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selected, ","), quote_identifier(table))
+	if len(clauses) > 0 { sql += " WHERE " + strings.Join(clauses, " AND ") }
+	if len(grouped) > 0 {
+		sql += fmt.Sprintf(" GROUP BY %s ORDER BY %s", strings.Join(grouped, ","), strings.Join(grouped, ","))
+	}
+	return sql, args, nil
+}
+
+// Decode a row of an aggregate query. Counts are integers, sums and averages
+// floats, and the other values are decoded like the column they come from.
+func decode_aggregate_row (row map[string]interface{}, columns []Column, query *core.AggregateQuery) (map[string]interface{}, error) {
+	decode := func (value interface{}, column Column) (interface{}, error) {
+		if value == nil { return nil, nil }
+		return decode_column_value(value, column)
+	}
+
+	decoded := map[string]interface{}{}
+	for _, name := range query.GroupBy {
+		column, err := find_column(columns, name)
+		if err != nil { return nil, err }
+		if decoded[name], err = decode(row[name], column); err != nil { return nil, err }
+	}
+	for _, metric := range query.Metrics {
+		var column Column
+		switch metric.Function {
+		case core.AggregateFunction_COUNT:
+			column = Column{ Name: metric.Name(), Type: ColType_INT }
+		case core.AggregateFunction_SUM, core.AggregateFunction_AVG:
+			column = Column{ Name: metric.Name(), Type: ColType_FLOAT }
+		default:
+			var err error
+			column, err = find_column(columns, metric.Field)
+			if err != nil { return nil, err }
+		}
+		value, err := decode(row[metric.Name()], column)
+		if err != nil { return nil, err }
+		decoded[metric.Name()] = value
+	}
+	return decoded, nil
+}
+
+func mysql_aggregate (db *sqlx.DB, table string, columns []Column, query *core.AggregateQuery) ([]map[string]interface{}, error) {
+	sql, args, err := aggregate_query_to_sql(table, columns, query)
+	if err != nil { return nil, err }
+
+	rows, err := db.Queryx(sql, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil { return nil, err }
+		decoded, err := decode_aggregate_row(row, columns, query)
+		if err != nil { return nil, err }
+		results = append(results, decoded)
+	}
+	return results, rows.Err()
+}
+
+func distinct_query_to_sql (table string, columns []Column, field string, constraints []core.Constraint, limit int) (string, []interface{}, error) {
+	column, err := find_column(columns, field)
+	if err != nil { return "", nil, err }
+	clauses, args, err := constraints_to_sql_clauses(constraints, columns)
+	if err != nil { return "", nil, err }
+
+	name := quote_identifier(column.Name)
+	sql := fmt.Sprintf("SELECT %s AS `value`, COUNT(*) AS `count` FROM %s", name, quote_identifier(table))
+	if len(clauses) > 0 { sql += " WHERE " + strings.Join(clauses, " AND ") }
+	sql += fmt.Sprintf(" GROUP BY %s ORDER BY `count` DESC, %s LIMIT %d", name, name, limit)
+	return sql, args, nil
+}
+
+func mysql_distinct (db *sqlx.DB, table string, columns []Column, field string, constraints []core.Constraint, limit int) ([]*core.DistinctValue, error) {
+	sql, args, err := distinct_query_to_sql(table, columns, field, constraints, limit)
+	if err != nil { return nil, err }
+	column, _ := find_column(columns, field)
+
+	rows, err := db.Queryx(sql, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	values := []*core.DistinctValue{}
+	for rows.Next() {
+		var value interface{}
+		var count int
+		if err := rows.Scan(&value, &count); err != nil { return nil, err }
+		if value != nil {
+			if value, err = decode_column_value(value, column); err != nil { return nil, err }
+		}
+		values = append(values, &core.DistinctValue{ Value: value, Count: count })
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,91 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlAggregateQuery (t *testing.T) {
+	columns := []Column{
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "location", Type: ColType_STRING },
+		{ Name: "age", Type: ColType_INT, Nullable: true },
+	}
+
+	t.Run("group by with constraints", func (t *testing.T) {
+		sql, args, err := aggregate_query_to_sql("Users", columns, &core.AggregateQuery{
+			GroupBy: []string{ "location" },
+			Metrics: []core.Metric{
+				{ Function: core.AggregateFunction_COUNT, Field: "*" },
+				{ Function: core.AggregateFunction_AVG, Field: "age" },
+			},
+			Constraints: []core.Constraint{{ Property: "age", Value: "20", Comparison: core.Comparison_GT }},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT `location`,COUNT(*) AS `count(*)`,AVG(`age`) AS `avg(age)` FROM `Users` WHERE `age` > ? GROUP BY `location` ORDER BY `location`", sql)
+		assert.Equal(t, []interface{}{ int64(20) }, args)
+	});
+
+	t.Run("without grouping", func (t *testing.T) {
+		sql, _, err := aggregate_query_to_sql("Users", columns, &core.AggregateQuery{
+			Metrics: []core.Metric{{ Function: core.AggregateFunction_MAX, Field: "age" }},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT MAX(`age`) AS `max(age)` FROM `Users`", sql)
+	});
+
+	t.Run("unknown field", func (t *testing.T) {
+		_, _, err := aggregate_query_to_sql("Users", columns, &core.AggregateQuery{
+			GroupBy: []string{ "height" },
+			Metrics: []core.Metric{{ Function: core.AggregateFunction_COUNT, Field: "*" }},
+		})
+		assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+		assert.Equal(t, "unknown_field", core.NewProblem(err).Code)
+	});
+
+	t.Run("decoding", func (t *testing.T) {
+		query := &core.AggregateQuery{
+			GroupBy: []string{ "location" },
+			Metrics: []core.Metric{
+				{ Function: core.AggregateFunction_COUNT, Field: "*" },
+				{ Function: core.AggregateFunction_AVG, Field: "age" },
+				{ Function: core.AggregateFunction_MIN, Field: "age" },
+				{ Function: core.AggregateFunction_SUM, Field: "age" },
+			},
+		}
+		row, err := decode_aggregate_row(map[string]interface{}{
+			"location": []byte("Texas"),
+			"count(*)": int64(2),
+			"avg(age)": []byte("25.5000"),
+			"min(age)": []byte("20"),
+			"sum(age)": nil,
+		}, columns, query)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"location": "Texas",
+			"count(*)": int64(2),
+			"avg(age)": 25.5,
+			"min(age)": int64(20),
+			"sum(age)": nil,
+		}, row)
+	});
+}
+
+func TestMysqlDistinctQuery (t *testing.T) {
+	columns := []Column{
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "location", Type: ColType_STRING, Nullable: true },
+	}
+
+	sql, args, err := distinct_query_to_sql("Users", columns, "location", []core.Constraint{
+		{ Property: "name", Value: "Kim", Comparison: core.Comparison_GE },
+	}, 11)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT `location` AS `value`, COUNT(*) AS `count` FROM `Users` WHERE `name` >= ? GROUP BY `location` ORDER BY `count` DESC, `location` LIMIT 11", sql)
+	assert.Equal(t, []interface{}{ "Kim" }, args)
+
+	_, _, err = distinct_query_to_sql("Users", columns, "height", nil, 11)
+	assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+}
@@ -0,0 +1,207 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// Maximum number of placeholders in a MySQL prepared statement.
+	_mysqlMaxPlaceholders = 65535
+	// Used when the server does not report its max_allowed_packet.
+	_mysqlDefaultMaxPacket = 4 << 20
+)
+
+// Convert a json decoded entry value into the argument bound for `column`.
+func encode_entry_value (value interface{}, column Column) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		if !column.Nullable { return nil, fmt.Errorf("field \"%s\" cannot be null", column.Name) }
+		return nil, nil
+	case string:
+		return encode_column_value(v, column)
+	case json.Number:
+		return encode_column_value(v.String(), column)
+	case float64:
+		return encode_column_value(strconv.FormatFloat(v, 'f', -1, 64), column)
+	case int:
+		return encode_column_value(strconv.Itoa(v), column)
+	case int64:
+		return encode_column_value(strconv.FormatInt(v, 10), column)
+	case bool:
+		if column.Type != ColType_BOOL { return nil, fmt.Errorf("field \"%s\" does not accept a boolean", column.Name) }
+		return encode_column_value(strconv.FormatBool(v), column)
+	case time.Time:
+		return encode_column_value(v.Format(time.RFC3339Nano), column)
+	case map[string]interface{}, []interface{}:
+		if column.Type != ColType_JSON { return nil, fmt.Errorf("field \"%s\" does not accept a json object or array", column.Name) }
+		encoded, err := json.Marshal(v)
+		if err != nil { return nil, err }
+		return string(encoded), nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T for field \"%s\"", value, column.Name)
+}
+
+// Approximate number of bytes an argument takes in a packet.
+func arg_size (arg interface{}) int {
+	switch v := arg.(type) {
+	case string: return len(v)
+	case []byte: return len(v)
+	}
+	return 8
+}
+
+type bulk_statement struct {
+	query string
+	args []interface{}
+	// Position of the entries inserted by the statement.
+	rows []int
+}
+
+// Build the placeholder INSERT statements inserting `entries` into `table`.
+// Rows are split across statements so that each statement stays below
+// `max_packet` bytes and the placeholder limit. Entries that cannot be
+// encoded are reported with a `*core.BulkInsertError`.
+func bulk_insert_statements (table string, columns []Column, entries []map[string]interface{}, max_packet int) ([]*bulk_statement, error) {
+	if len(columns) == 0 { return nil, fmt.Errorf("must be at least 1 entry in the columns") }
+	if max_packet <= 0 { max_packet = _mysqlDefaultMaxPacket }
+
+	known := map[string]bool{}
+	for _, c := range columns {
+		known[c.Name] = true
+	}
+
+	// Only insert the columns that appear in at least one entry, the other
+	// columns keep their default value.
+	used := map[string]bool{}
+	bulk_err := &core.BulkInsertError{}
+	for i, entry := range entries {
+		for k := range entry {
+			if !known[k] {
+				bulk_err.Errors = append(bulk_err.Errors, &core.RowError{ Index: i, Message: fmt.Sprintf("unknown field \"%s\"", k) })
+				continue
+			}
+			used[k] = true
+		}
+	}
+	insert_columns := []Column{}
+	for _, c := range columns {
+		if used[c.Name] { insert_columns = append(insert_columns, c) }
+	}
+	if len(bulk_err.Errors) == 0 && len(insert_columns) == 0 {
+		return nil, core.ValidationErrorf("unknown_field", "entries do not hold any known field")
+	}
+
+	fragments := make([]string, len(entries))
+	args := make([][]interface{}, len(entries))
+	for i, entry := range entries {
+		placeholders := []string{}
+		for _, c := range insert_columns {
+			value, exists := entry[c.Name]
+			if !exists {
+				placeholders = append(placeholders, "DEFAULT")
+				continue
+			}
+			arg, err := encode_entry_value(value, c)
+			if err != nil {
+				bulk_err.Errors = append(bulk_err.Errors, &core.RowError{ Index: i, Message: err.Error() })
+				continue
+			}
+			placeholders = append(placeholders, "?")
+			args[i] = append(args[i], arg)
+		}
+		fragments[i] = fmt.Sprintf("(%s)", strings.Join(placeholders, ","))
+	}
+	if len(bulk_err.Errors) > 0 { return nil, bulk_err }
+
+	header := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quote_identifier(table), strings.Join(column_field_names(insert_columns), ","))
+	// Leave room for the protocol overhead.
+	budget := max_packet - max_packet / 10
+
+	statements := []*bulk_statement{}
+	var current *bulk_statement
+	var size int
+	var values []string
+	flush := func () {
+		if current == nil { return }
+		current.query = header + strings.Join(values, ",")
+		statements = append(statements, current)
+		current = nil
+	}
+	for i := range entries {
+		row_size := len(fragments[i]) + 1
+		for _, arg := range args[i] {
+			row_size += arg_size(arg)
+		}
+		if current != nil && (size + row_size > budget || len(current.args) + len(args[i]) > _mysqlMaxPlaceholders) {
+			flush()
+		}
+		if current == nil {
+			current = &bulk_statement{}
+			size = len(header)
+			values = []string{}
+		}
+		current.args = append(current.args, args[i]...)
+		current.rows = append(current.rows, i)
+		values = append(values, fragments[i])
+		size += row_size
+	}
+	flush()
+	return statements, nil
+}
+
+// Insert the `entries` in a single transaction. When the insertion fails, the
+// entries are inserted one by one in a throwaway transaction to report which
+// ones the database rejects.
+func mysql_insert_many (db *sqlx.DB, table string, columns []Column, entries []map[string]interface{}) (int, error) {
+	var max_packet int
+	if err := db.Get(&max_packet, "SELECT @@max_allowed_packet"); err != nil { return 0, err }
+
+	statements, err := bulk_insert_statements(table, columns, entries, max_packet)
+	if err != nil { return 0, err }
+
+	tx, err := db.Beginx()
+	if err != nil { return 0, err }
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement.query, statement.args...); err != nil { break }
+	}
+	if err == nil {
+		if err = tx.Commit(); err == nil { return len(entries), nil }
+	}
+	tx.Rollback()
+
+	// The entries are not at fault when the server cannot be reached.
+	if is_connection_error(err) { return 0, err }
+	if row_errors := diagnose_insert_many(db, table, columns, entries, max_packet); len(row_errors) > 0 {
+		return 0, &core.BulkInsertError{ Errors: row_errors }
+	}
+	return 0, err
+}
+
+func diagnose_insert_many (db *sqlx.DB, table string, columns []Column, entries []map[string]interface{}, max_packet int) []*core.RowError {
+	row_errors := []*core.RowError{}
+	tx, err := db.Beginx()
+	if err != nil { return row_errors }
+	defer tx.Rollback()
+
+	for i, entry := range entries {
+		statements, err := bulk_insert_statements(table, columns, []map[string]interface{}{ entry }, max_packet)
+		if err != nil {
+			row_errors = append(row_errors, &core.RowError{ Index: i, Message: err.Error() })
+			continue
+		}
+		if _, err := tx.Exec("SAVEPOINT easyapi_row"); err != nil { return row_errors }
+		if _, err := tx.Exec(statements[0].query, statements[0].args...); err != nil {
+			if is_connection_error(err) { return nil }
+			row_errors = append(row_errors, &core.RowError{ Index: i, Message: err.Error() })
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT easyapi_row"); err != nil { return row_errors }
+		}
+	}
+	return row_errors
+}
@@ -0,0 +1,131 @@
+package drivers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlBulkInsertStatements (t *testing.T) {
+	columns := []Column{
+		{ Name: "id", Type: ColType_INT },
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "location", Type: ColType_STRING, Nullable: true },
+		{ Name: "tags", Type: ColType_JSON, Nullable: true },
+	}
+
+	t.Run("placeholders and defaults", func (t *testing.T) {
+		statements, err := bulk_insert_statements("Users", columns, []map[string]interface{}{
+			{ "id": json.Number("1"), "name": `Robert"); DROP TABLE Users; --`, "location": nil },
+			{ "id": json.Number("2"), "name": "Alex" },
+		}, 0)
+		assert.NoError(t, err)
+		assert.Len(t, statements, 1)
+		assert.Equal(t, "INSERT INTO `Users` (`id`,`name`,`location`) VALUES (?,?,?),(?,?,DEFAULT)", statements[0].query)
+		assert.Equal(t, []interface{}{ int64(1), `Robert"); DROP TABLE Users; --`, nil, int64(2), "Alex" }, statements[0].args)
+		assert.Equal(t, []int{ 0, 1 }, statements[0].rows)
+	});
+
+	t.Run("json values", func (t *testing.T) {
+		statements, err := bulk_insert_statements("Users", columns, []map[string]interface{}{
+			{ "id": 1, "name": "Alex", "tags": []interface{}{ "a", "b" } },
+		}, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ int64(1), "Alex", `["a","b"]` }, statements[0].args)
+	});
+
+	t.Run("per row errors", func (t *testing.T) {
+		_, err := bulk_insert_statements("Users", columns, []map[string]interface{}{
+			{ "id": 1, "name": "Alex" },
+			{ "id": "one", "name": "Jimmy" },
+			{ "id": 3, "name": nil },
+			{ "id": 4, "name": "John", "age": 30 },
+		}, 0)
+		var bulk_err *core.BulkInsertError
+		assert.ErrorAs(t, err, &bulk_err)
+		if bulk_err == nil { return }
+
+		indexes := []int{}
+		for _, row := range bulk_err.Errors {
+			indexes = append(indexes, row.Index)
+		}
+		assert.ElementsMatch(t, []int{ 1, 2, 3 }, indexes)
+		_, err = bulk_insert_statements("Users", columns, []map[string]interface{}{{}}, 0)
+		assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+	});
+
+	t.Run("chunked by packet size", func (t *testing.T) {
+		entries := []map[string]interface{}{}
+		for i := 0; i < 10; i++ {
+			entries = append(entries, map[string]interface{}{ "id": i, "name": strings.Repeat("x", 100) })
+		}
+		statements, err := bulk_insert_statements("Users", columns, entries, 500)
+		assert.NoError(t, err)
+		assert.Greater(t, len(statements), 1)
+
+		rows := []int{}
+		for _, statement := range statements {
+			assert.Equal(t, 2 * len(statement.rows), len(statement.args))
+			assert.Equal(t, len(statement.rows), strings.Count(statement.query, "(?,?)"))
+			rows = append(rows, statement.rows...)
+		}
+		assert.Equal(t, []int{ 0, 1, 2, 3, 4, 5, 6, 7, 8, 9 }, rows)
+	});
+
+	t.Run("chunked by placeholder count", func (t *testing.T) {
+		entries := []map[string]interface{}{}
+		for i := 0; i < 40000; i++ {
+			entries = append(entries, map[string]interface{}{ "id": i, "name": "x" })
+		}
+		statements, err := bulk_insert_statements("Users", columns, entries, 1 << 30)
+		assert.NoError(t, err)
+		assert.Len(t, statements, 2)
+		for _, statement := range statements {
+			assert.LessOrEqual(t, len(statement.args), _mysqlMaxPlaceholders)
+		}
+	});
+}
+
+func TestMysqlInsertMany (t *testing.T) {
+	skip_without_mysql(t)
+	var dbname string = hash("test_database")
+	assert.NoError(t, setup_database(dbname))
+	defer func () { assert.NoError(t, cleanup_database(dbname)) }()
+
+	assert.NoError(t, execute_query(dbname, `CREATE TABLE Users (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255) NOT NULL
+	)`))
+	columns := []Column{
+		{ Name: "id", Type: ColType_INT, PrimaryKey: true },
+		{ Name: "name", Type: ColType_STRING },
+	}
+	provider, err := CreateMysqlDataProvider(&MysqlConfig{ Primary: MysqlConnectionString(dbname) }, "Users", columns)
+	assert.NoError(t, err)
+
+	inserted, err := provider.InsertMany([]map[string]interface{}{
+		{ "id": 1, "name": "John" },
+		{ "id": 2, "name": "Jimmy" },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, inserted)
+
+	// The duplicate key is reported on the offending row and nothing is inserted.
+	_, err = provider.InsertMany([]map[string]interface{}{
+		{ "id": 3, "name": "Alex" },
+		{ "id": 1, "name": "John again" },
+	})
+	var bulk_err *core.BulkInsertError
+	assert.ErrorAs(t, err, &bulk_err)
+	if bulk_err != nil {
+		assert.Len(t, bulk_err.Errors, 1)
+		assert.Equal(t, 1, bulk_err.Errors[0].Index)
+	}
+
+	entries, err := provider.All(0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,297 @@
+package drivers
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Error number of the server for a duplicate unique key.
+const _mysqlErrDuplicateEntry = 1062
+
+type ReplicaSelection int
+const (
+	// Cycle through the healthy replicas in order.
+	ReplicaSelection_ROUND_ROBIN ReplicaSelection = 0
+	// Pick the healthy replica with the fewest queries in flight.
+	ReplicaSelection_LEAST_CONNECTIONS ReplicaSelection = 1
+)
+
+// Connection settings of a single MySQL server.
+type MysqlConnection struct {
+	User string
+	Password string
+	Database string
+	// Default: "127.0.0.1"
+	Host string
+	// Default: 3306
+	Port int
+	// Path of a unix socket. If set, `Host` and `Port` are ignored.
+	Socket string
+	// If set, the connection is encrypted with the given TLS configuration.
+	TLS *tls.Config
+	// e.g. "utf8mb4"
+	Charset string
+	// e.g. "utf8mb4_unicode_ci"
+	Collation string
+	// Decode DATE and DATETIME columns as `time.Time`.
+	ParseTime bool
+	// Dial timeout.
+	Timeout time.Duration
+	ReadTimeout time.Duration
+	WriteTimeout time.Duration
+	// Any other driver parameter, e.g. { "sql_mode": "'ANSI_QUOTES'" }.
+	Params map[string]string
+}
+
+func (c *MysqlConnection) driver_config () *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.DBName = c.Database
+	if len(c.Socket) > 0 {
+		cfg.Net = "unix"
+		cfg.Addr = c.Socket
+	} else {
+		host := c.Host
+		if len(host) == 0 { host = "127.0.0.1" }
+		port := c.Port
+		if port == 0 { port = 3306 }
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	cfg.TLS = c.TLS
+	if len(c.Collation) > 0 { cfg.Collation = c.Collation }
+	cfg.ParseTime = c.ParseTime
+	cfg.Timeout = c.Timeout
+	cfg.ReadTimeout = c.ReadTimeout
+	cfg.WriteTimeout = c.WriteTimeout
+
+	cfg.Params = map[string]string{}
+	for k, v := range c.Params {
+		cfg.Params[k] = v
+	}
+	if len(c.Charset) > 0 { cfg.Params["charset"] = c.Charset }
+	return cfg
+}
+
+// Names under which custom TLS configurations were registered with the driver.
+var _registeredTlsConfigs sync.Map
+
+func register_tls_config (config *tls.Config) (string, error) {
+	if name, ok := _registeredTlsConfigs.Load(config); ok { return name.(string), nil }
+	name := fmt.Sprintf("easyapi-%p", config)
+	if err := mysql.RegisterTLSConfig(name, config); err != nil { return "", err }
+	actual, _ := _registeredTlsConfigs.LoadOrStore(config, name)
+	return actual.(string), nil
+}
+
+// Format the connection as a DSN string. A custom `TLS` configuration is
+// registered with the driver and referenced by name, so the DSN can be
+// passed to `sql.Open("mysql", ...)` within this process.
+func (c *MysqlConnection) DSN () (string, error) {
+	cfg := c.driver_config()
+	if cfg.TLS != nil {
+		name, err := register_tls_config(cfg.TLS)
+		if err != nil { return "", err }
+		cfg.TLS = nil
+		cfg.TLSConfig = name
+	}
+	return cfg.FormatDSN(), nil
+}
+
+type MysqlConfig struct {
+	// DSN of the primary database, e.g. "user:password@tcp(127.0.0.1:3306)/database".
+	// Writes are always sent to the primary.
+	Primary string
+	// Connection settings of the primary, used instead of `Primary` when set.
+	PrimaryConnection *MysqlConnection
+	// DSNs of the read replicas. Reads are spread across the healthy replicas
+	// and fall back to the primary when none is available.
+	Replicas []string
+	// Connection settings of additional read replicas.
+	ReplicaConnections []*MysqlConnection
+	// How reads are distributed across the replicas.
+	// Default: ReplicaSelection_ROUND_ROBIN
+	ReplicaSelection ReplicaSelection
+	// How long a replica that failed with a connection error is kept out of
+	// the rotation.
+	// Default: 30 seconds
+	EjectionDuration time.Duration
+}
+
+type mysql_node struct {
+	// DSN or address of the node, used to identify it.
+	dsn string
+	config *mysql.Config
+	open_once sync.Once
+	db *sqlx.DB
+	open_err error
+	// Number of queries currently running against this node.
+	active int64
+	// Unix nanoseconds until which the node is considered unhealthy.
+	ejected_until int64
+}
+
+func (n *mysql_node) connection () (*sqlx.DB, error) {
+	n.open_once.Do(func () {
+		connector, err := mysql.NewConnector(n.config)
+		if err != nil {
+			n.open_err = err
+			return
+		}
+		n.db = sqlx.NewDb(sql.OpenDB(connector), "mysql")
+	})
+	return n.db, n.open_err
+}
+
+func (n *mysql_node) healthy (now time.Time) bool {
+	return atomic.LoadInt64(&n.ejected_until) <= now.UnixNano()
+}
+
+type mysql_cluster struct {
+	primary *mysql_node
+	replicas []*mysql_node
+	selection ReplicaSelection
+	ejection time.Duration
+	next uint64
+	now func() time.Time
+}
+
+func create_mysql_node_from_dsn (dsn string) (*mysql_node, error) {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil { return nil, err }
+	return &mysql_node{ dsn: dsn, config: config }, nil
+}
+
+func create_mysql_node_from_connection (connection *MysqlConnection) (*mysql_node, error) {
+	if connection == nil { return nil, fmt.Errorf("mysql connection cannot be nil") }
+	config := connection.driver_config()
+	return &mysql_node{ dsn: config.Addr, config: config }, nil
+}
+
+func create_mysql_cluster (config *MysqlConfig) (*mysql_cluster, error) {
+	if config == nil { return nil, fmt.Errorf("mysql config cannot be nil") }
+	if len(config.Primary) == 0 && config.PrimaryConnection == nil {
+		return nil, fmt.Errorf("mysql config must define a primary dsn or connection")
+	}
+	if config.ReplicaSelection != ReplicaSelection_ROUND_ROBIN && config.ReplicaSelection != ReplicaSelection_LEAST_CONNECTIONS {
+		return nil, fmt.Errorf("unknown replica selection: %d", config.ReplicaSelection)
+	}
+
+	var primary *mysql_node
+	var err error
+	if config.PrimaryConnection != nil {
+		primary, err = create_mysql_node_from_connection(config.PrimaryConnection)
+	} else {
+		primary, err = create_mysql_node_from_dsn(config.Primary)
+	}
+	if err != nil { return nil, err }
+
+	cluster := &mysql_cluster{
+		primary: primary,
+		selection: config.ReplicaSelection,
+		ejection: config.EjectionDuration,
+		now: time.Now,
+	}
+	if cluster.ejection <= 0 { cluster.ejection = 30 * time.Second }
+	for _, dsn := range config.Replicas {
+		replica, err := create_mysql_node_from_dsn(dsn)
+		if err != nil { return nil, err }
+		cluster.replicas = append(cluster.replicas, replica)
+	}
+	for _, connection := range config.ReplicaConnections {
+		replica, err := create_mysql_node_from_connection(connection)
+		if err != nil { return nil, err }
+		cluster.replicas = append(cluster.replicas, replica)
+	}
+	return cluster, nil
+}
+
+// Select the node that should serve a read, skipping the nodes in `exclude`.
+// Falls back to the primary when no replica is healthy.
+func (c *mysql_cluster) reader (exclude map[*mysql_node]bool) *mysql_node {
+	now := c.now()
+	healthy := []*mysql_node{}
+	for _, r := range c.replicas {
+		if !exclude[r] && r.healthy(now) { healthy = append(healthy, r) }
+	}
+	if len(healthy) == 0 { return c.primary }
+
+	switch c.selection {
+	case ReplicaSelection_LEAST_CONNECTIONS:
+		best := healthy[0]
+		for _, r := range healthy[1:] {
+			if atomic.LoadInt64(&r.active) < atomic.LoadInt64(&best.active) { best = r }
+		}
+		return best
+	default:
+		i := atomic.AddUint64(&c.next, 1) - 1
+		return healthy[i % uint64(len(healthy))]
+	}
+}
+
+// Select the node that should serve a write.
+func (c *mysql_cluster) writer () *mysql_node {
+	return c.primary
+}
+
+func (c *mysql_cluster) eject (node *mysql_node) {
+	atomic.StoreInt64(&node.ejected_until, c.now().Add(c.ejection).UnixNano())
+}
+
+func is_connection_error (err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) { return true }
+	var net_err net.Error
+	return errors.As(err, &net_err)
+}
+
+// Give a kind to the errors of the server: connection errors make the
+// backend unavailable and duplicate keys are conflicts.
+func translate_mysql_error (err error) error {
+	if err == nil || core.KindOf(err) != core.ErrorKind_UNDEF { return err }
+	if is_connection_error(err) { return core.UnavailableError(err) }
+	var mysql_err *mysql.MySQLError
+	if errors.As(err, &mysql_err) && mysql_err.Number == _mysqlErrDuplicateEntry {
+		return core.ConflictErrorf("duplicate_key", "%s: %w", mysql_err.Message, err)
+	}
+	return err
+}
+
+// Run `fn` against `node`, keeping track of the number of active queries.
+func (c *mysql_cluster) run (node *mysql_node, fn func(db *sqlx.DB) error) error {
+	db, err := node.connection()
+	if err != nil { return err }
+	atomic.AddInt64(&node.active, 1)
+	defer atomic.AddInt64(&node.active, -1)
+	return translate_mysql_error(fn(db))
+}
+
+// Run the read `fn` on a replica. A replica failing with a connection error
+// is ejected and the read is retried on the next candidate.
+func (c *mysql_cluster) read (fn func(db *sqlx.DB) error) error {
+	tried := map[*mysql_node]bool{}
+	for {
+		node := c.reader(tried)
+		err := c.run(node, fn)
+		if err == nil || node == c.primary || !is_connection_error(err) { return err }
+		c.eject(node)
+		tried[node] = true
+	}
+}
+
+// Run the write `fn` on the primary.
+func (c *mysql_cluster) write (fn func(db *sqlx.DB) error) error {
+	return c.run(c.writer(), fn)
+}
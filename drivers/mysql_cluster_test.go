@@ -0,0 +1,222 @@
+package drivers
+
+import (
+	"crypto/tls"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func test_dsn (host string) string {
+	return fmt.Sprintf("root@tcp(%s:3306)/db", host)
+}
+
+func TestMysqlCluster (t *testing.T) {
+	t.Run("requires a primary", func (t *testing.T) {
+		_, err := create_mysql_cluster(&MysqlConfig{ Replicas: []string{ "replica" } })
+		assert.ErrorContains(t, err, "primary")
+	});
+
+	t.Run("reads fall back to the primary without replicas", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{ Primary: test_dsn("primary") })
+		assert.NoError(t, err)
+		assert.Equal(t, cluster.primary, cluster.reader(nil))
+		assert.Equal(t, cluster.primary, cluster.writer())
+	});
+
+	t.Run("round robin", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{
+			Primary: test_dsn("primary"),
+			Replicas: []string{ test_dsn("a"), test_dsn("b"), test_dsn("c") },
+		})
+		assert.NoError(t, err)
+
+		selected := []string{}
+		for i := 0; i < 6; i++ {
+			selected = append(selected, cluster.reader(nil).dsn)
+		}
+		assert.Equal(t, []string{ test_dsn("a"), test_dsn("b"), test_dsn("c"), test_dsn("a"), test_dsn("b"), test_dsn("c") }, selected)
+		assert.Equal(t, test_dsn("primary"), cluster.writer().dsn)
+	});
+
+	t.Run("least connections", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{
+			Primary: test_dsn("primary"),
+			Replicas: []string{ test_dsn("a"), test_dsn("b"), test_dsn("c") },
+			ReplicaSelection: ReplicaSelection_LEAST_CONNECTIONS,
+		})
+		assert.NoError(t, err)
+
+		atomic.StoreInt64(&cluster.replicas[0].active, 3)
+		atomic.StoreInt64(&cluster.replicas[1].active, 1)
+		atomic.StoreInt64(&cluster.replicas[2].active, 2)
+		assert.Equal(t, test_dsn("b"), cluster.reader(nil).dsn)
+	});
+
+	t.Run("ejected replicas leave the rotation until the ejection expires", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{
+			Primary: test_dsn("primary"),
+			Replicas: []string{ test_dsn("a"), test_dsn("b") },
+			EjectionDuration: time.Minute,
+		})
+		assert.NoError(t, err)
+
+		now := time.Now()
+		cluster.now = func () time.Time { return now }
+
+		cluster.eject(cluster.replicas[0])
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, test_dsn("b"), cluster.reader(nil).dsn)
+		}
+
+		cluster.eject(cluster.replicas[1])
+		assert.Equal(t, test_dsn("primary"), cluster.reader(nil).dsn)
+
+		now = now.Add(2 * time.Minute)
+		assert.NotEqual(t, test_dsn("primary"), cluster.reader(nil).dsn)
+	});
+
+	t.Run("reads retry on the next replica after a connection error", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{
+			Primary: test_dsn("primary"),
+			Replicas: []string{ "root@tcp(a:3306)/db", "root@tcp(b:3306)/db" },
+		})
+		assert.NoError(t, err)
+
+		calls := 0
+		err = cluster.read(func (db *sqlx.DB) error {
+			calls++
+			if calls == 1 { return driver.ErrBadConn }
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.False(t, cluster.replicas[0].healthy(time.Now()))
+		assert.True(t, cluster.replicas[1].healthy(time.Now()))
+	});
+
+	t.Run("query errors do not eject replicas", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{
+			Primary: test_dsn("primary"),
+			Replicas: []string{ "root@tcp(a:3306)/db" },
+		})
+		assert.NoError(t, err)
+
+		calls := 0
+		err = cluster.read(func (db *sqlx.DB) error {
+			calls++
+			return fmt.Errorf("syntax error")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+		assert.True(t, cluster.replicas[0].healthy(time.Now()))
+	});
+
+	t.Run("errors get a kind", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{ Primary: test_dsn("primary") })
+		assert.NoError(t, err)
+
+		err = cluster.read(func (db *sqlx.DB) error { return driver.ErrBadConn })
+		assert.Equal(t, core.ErrorKind_UNAVAILABLE, core.KindOf(err))
+		assert.ErrorIs(t, err, driver.ErrBadConn)
+
+		err = cluster.write(func (db *sqlx.DB) error {
+			return &mysql.MySQLError{ Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'" }
+		})
+		assert.Equal(t, core.ErrorKind_CONFLICT, core.KindOf(err))
+		assert.Equal(t, "duplicate_key", core.NewProblem(err).Code)
+
+		err = cluster.write(func (db *sqlx.DB) error { return fmt.Errorf("syntax error") })
+		assert.Equal(t, core.ErrorKind_UNDEF, core.KindOf(err))
+	});
+
+	t.Run("invalid replica dsn", func (t *testing.T) {
+		_, err := create_mysql_cluster(&MysqlConfig{
+			Primary: test_dsn("primary"),
+			Replicas: []string{ "not a dsn" },
+		})
+		assert.Error(t, err)
+	});
+
+	t.Run("replica connections", func (t *testing.T) {
+		cluster, err := create_mysql_cluster(&MysqlConfig{
+			PrimaryConnection: &MysqlConnection{ Host: "primary.db", User: "root", Database: "db" },
+			Replicas: []string{ test_dsn("a") },
+			ReplicaConnections: []*MysqlConnection{{ Host: "b.db", Port: 3307, User: "root", Database: "db" }},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "primary.db:3306", cluster.primary.config.Addr)
+		assert.Len(t, cluster.replicas, 2)
+		assert.Equal(t, "b.db:3307", cluster.replicas[1].config.Addr)
+	});
+}
+
+func TestMysqlConnection (t *testing.T) {
+	t.Run("defaults", func (t *testing.T) {
+		dsn, err := (&MysqlConnection{ User: "root", Password: "password", Database: "app" }).DSN()
+		assert.NoError(t, err)
+		assert.Equal(t, "root:password@tcp(127.0.0.1:3306)/app", dsn)
+	});
+
+	t.Run("host, port and parameters", func (t *testing.T) {
+		connection := &MysqlConnection{
+			User: "app",
+			Password: "secret",
+			Database: "orders",
+			Host: "db.example.com",
+			Port: 3307,
+			Charset: "utf8mb4",
+			Collation: "utf8mb4_unicode_ci",
+			ParseTime: true,
+			Timeout: 5 * time.Second,
+			ReadTimeout: 30 * time.Second,
+			Params: map[string]string{ "autocommit": "true" },
+		}
+		dsn, err := connection.DSN()
+		assert.NoError(t, err)
+
+		parsed, err := mysql.ParseDSN(dsn)
+		assert.NoError(t, err)
+		assert.Equal(t, "tcp", parsed.Net)
+		assert.Equal(t, "db.example.com:3307", parsed.Addr)
+		assert.Equal(t, "orders", parsed.DBName)
+		assert.Equal(t, "utf8mb4_unicode_ci", parsed.Collation)
+		assert.True(t, parsed.ParseTime)
+		assert.Equal(t, 5 * time.Second, parsed.Timeout)
+		assert.Equal(t, 30 * time.Second, parsed.ReadTimeout)
+		assert.Equal(t, "utf8mb4", parsed.Params["charset"])
+		assert.Equal(t, "true", parsed.Params["autocommit"])
+	});
+
+	t.Run("unix socket", func (t *testing.T) {
+		dsn, err := (&MysqlConnection{ User: "root", Database: "app", Socket: "/var/run/mysqld/mysqld.sock", Host: "ignored" }).DSN()
+		assert.NoError(t, err)
+		assert.Equal(t, "root@unix(/var/run/mysqld/mysqld.sock)/app", dsn)
+	});
+
+	t.Run("tls", func (t *testing.T) {
+		tls_config := &tls.Config{ ServerName: "db.example.com" }
+		connection := &MysqlConnection{ User: "root", Database: "app", Host: "db.example.com", TLS: tls_config }
+
+		dsn, err := connection.DSN()
+		assert.NoError(t, err)
+		parsed, err := mysql.ParseDSN(dsn)
+		assert.NoError(t, err)
+		assert.NotNil(t, parsed.TLS)
+		assert.Equal(t, "db.example.com", parsed.TLS.ServerName)
+
+		// The configuration is only registered once.
+		again, err := connection.DSN()
+		assert.NoError(t, err)
+		assert.Equal(t, dsn, again)
+
+		assert.Same(t, tls_config, connection.driver_config().TLS)
+	});
+}
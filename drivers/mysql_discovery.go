@@ -0,0 +1,273 @@
+package drivers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/jmoiron/sqlx"
+)
+
+type MysqlDiscoveryOptions struct {
+	// Only expose these tables. If empty, every table of the database is exposed.
+	Tables []string
+	// Never expose these tables.
+	Exclude []string
+}
+
+func col_type_to_field_type (coltype ColType) core.FieldType {
+	switch coltype {
+	case ColType_INT: return core.FieldType_INT
+	case ColType_STRING: return core.FieldType_STRING
+	case ColType_FLOAT: return core.FieldType_FLOAT
+	case ColType_DECIMAL: return core.FieldType_DECIMAL
+	case ColType_BOOL: return core.FieldType_BOOL
+	case ColType_DATE: return core.FieldType_DATE
+	case ColType_DATETIME, ColType_TIMESTAMP: return core.FieldType_DATETIME
+	case ColType_JSON: return core.FieldType_JSON
+	case ColType_BLOB: return core.FieldType_BLOB
+	case ColType_UUID: return core.FieldType_UUID
+	case ColType_ENUM: return core.FieldType_ENUM
+	}
+	return core.FieldType_UNDEF
+}
+
+func column_to_field (column Column) *core.Field {
+	return &core.Field{
+		Name: column.Name,
+		Type: col_type_to_field_type(column.Type),
+		Nullable: column.Nullable,
+		PrimaryKey: column.PrimaryKey,
+		Values: column.Values,
+	}
+}
+
+// Parse the values of an "enum('a','b')" column type.
+func parse_enum_values (column_type string) []string {
+	start := strings.Index(column_type, "(")
+	end := strings.LastIndex(column_type, ")")
+	if start < 0 || end <= start { return nil }
+
+	values := []string{}
+	body := column_type[start+1:end]
+	for len(body) > 0 {
+		if body[0] != '\'' { break }
+		var value strings.Builder
+		i := 1
+		for ; i < len(body); i++ {
+			if body[i] == '\'' {
+				// A doubled quote is an escaped quote.
+				if i + 1 < len(body) && body[i+1] == '\'' {
+					value.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			value.WriteByte(body[i])
+		}
+		values = append(values, value.String())
+		body = strings.TrimPrefix(body[min(i+1, len(body)):], ",")
+	}
+	return values
+}
+
+// Map an INFORMATION_SCHEMA data type (e.g. "int") and column type
+// (e.g. "int unsigned", "tinyint(1)") to the column type used to decode it.
+func mysql_type_to_col_type (data_type, column_type string) (ColType, error) {
+	data_type = strings.ToLower(data_type)
+	column_type = strings.ToLower(column_type)
+	switch data_type {
+	case "tinyint":
+		if strings.HasPrefix(column_type, "tinyint(1)") { return ColType_BOOL, nil }
+		return ColType_INT, nil
+	case "smallint", "mediumint", "int", "integer", "bigint", "year":
+		return ColType_INT, nil
+	case "float", "double", "real":
+		return ColType_FLOAT, nil
+	case "decimal", "numeric":
+		return ColType_DECIMAL, nil
+	case "bit":
+		if column_type == "bit(1)" { return ColType_BOOL, nil }
+		return ColType_BLOB, nil
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "set", "time":
+		return ColType_STRING, nil
+	case "date":
+		return ColType_DATE, nil
+	case "datetime":
+		return ColType_DATETIME, nil
+	case "timestamp":
+		return ColType_TIMESTAMP, nil
+	case "json":
+		return ColType_JSON, nil
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return ColType_BLOB, nil
+	case "enum":
+		return ColType_ENUM, nil
+	}
+	return ColType_UNDEF, fmt.Errorf("unsupported mysql data type \"%s\"", data_type)
+}
+
+type information_schema_column struct {
+	TableName string `db:"TABLE_NAME"`
+	ColumnName string `db:"COLUMN_NAME"`
+	DataType string `db:"DATA_TYPE"`
+	ColumnType string `db:"COLUMN_TYPE"`
+	IsNullable string `db:"IS_NULLABLE"`
+	ColumnKey string `db:"COLUMN_KEY"`
+	ColumnDefault sql.NullString `db:"COLUMN_DEFAULT"`
+	Extra string `db:"EXTRA"`
+	ColumnComment string `db:"COLUMN_COMMENT"`
+}
+
+func information_schema_to_column (c information_schema_column) (Column, error) {
+	coltype, err := mysql_type_to_col_type(c.DataType, c.ColumnType)
+	if err != nil { return Column{}, fmt.Errorf("column \"%s.%s\": %w", c.TableName, c.ColumnName, err) }
+
+	column := Column{
+		Name: c.ColumnName,
+		Type: coltype,
+		Nullable: strings.EqualFold(c.IsNullable, "YES"),
+		PrimaryKey: strings.EqualFold(c.ColumnKey, "PRI"),
+	}
+	if coltype == ColType_ENUM { column.Values = parse_enum_values(c.ColumnType) }
+	return column, nil
+}
+
+// Read the INFORMATION_SCHEMA rows of the columns of the current database,
+// ordered by table and column position.
+func read_information_schema (db *sqlx.DB, tables []string) ([]information_schema_column, error) {
+	query := `SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, COLUMN_COMMENT
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE()`
+	args := []interface{}{}
+	if len(tables) > 0 {
+		query += fmt.Sprintf(" AND TABLE_NAME IN (?%s)", strings.Repeat(",?", len(tables) - 1))
+		for _, t := range tables {
+			args = append(args, t)
+		}
+	}
+	query += " ORDER BY TABLE_NAME, ORDINAL_POSITION"
+
+	rows := []information_schema_column{}
+	if err := db.Select(&rows, query, args...); err != nil { return nil, err }
+	return rows, nil
+}
+
+type information_schema_index_column struct {
+	IndexName string `db:"INDEX_NAME"`
+	ColumnName string `db:"COLUMN_NAME"`
+}
+
+// Read the indexes of `table` in the current database matching the sql
+// `condition`, as the list of the columns of each index.
+func read_index_columns (db *sqlx.DB, table string, condition string) ([][]string, error) {
+	rows := []information_schema_index_column{}
+	err := db.Select(&rows, fmt.Sprintf(`SELECT INDEX_NAME, COLUMN_NAME
+		FROM INFORMATION_SCHEMA.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND %s
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`, condition), table)
+	if err != nil { return nil, err }
+
+	keys := [][]string{}
+	var index string
+	for _, row := range rows {
+		if len(keys) == 0 || row.IndexName != index {
+			keys = append(keys, []string{})
+			index = row.IndexName
+		}
+		keys[len(keys) - 1] = append(keys[len(keys) - 1], row.ColumnName)
+	}
+	return keys, nil
+}
+
+// Read the primary and unique keys of `table`.
+func mysql_unique_keys (db *sqlx.DB, table string) ([][]string, error) {
+	return read_index_columns(db, table, "NON_UNIQUE = 0")
+}
+
+// Read the FULLTEXT indexes of `table`.
+func mysql_fulltext_indexes (db *sqlx.DB, table string) ([][]string, error) {
+	return read_index_columns(db, table, "INDEX_TYPE = 'FULLTEXT'")
+}
+
+// Whether `keys` hold the same columns as one of the `indexes`, in any order.
+func has_index (indexes [][]string, keys []string) bool {
+	for _, key := range indexes {
+		if len(key) != len(keys) { continue }
+		matched := true
+		for _, column := range keys {
+			found := false
+			for _, c := range key {
+				if strings.EqualFold(c, column) { found = true }
+			}
+			matched = matched && found
+		}
+		if matched { return true }
+	}
+	return false
+}
+
+// Read the column definitions of the tables of the current database,
+// grouped by table name, in column order.
+func discover_mysql_columns (db *sqlx.DB, options *MysqlDiscoveryOptions) ([]string, map[string][]Column, error) {
+	var filter []string
+	excluded := map[string]bool{}
+	if options != nil {
+		filter = options.Tables
+		for _, t := range options.Exclude {
+			excluded[t] = true
+		}
+	}
+
+	rows, err := read_information_schema(db, filter)
+	if err != nil { return nil, nil, err }
+
+	tables := []string{}
+	columns := map[string][]Column{}
+	for _, row := range rows {
+		if excluded[row.TableName] { continue }
+		column, err := information_schema_to_column(row)
+		if err != nil { return nil, nil, err }
+		if _, ok := columns[row.TableName]; !ok { tables = append(tables, row.TableName) }
+		columns[row.TableName] = append(columns[row.TableName], column)
+	}
+	return tables, columns, nil
+}
+
+// Introspect the database of `config` and create a schema, backed by a MySQL
+// data provider, for every table. The returned schemas can be passed as is to
+// `core.Config.Schemas`. All the providers share the connections of `config`.
+func DiscoverMysqlSchemas (config *MysqlConfig, options *MysqlDiscoveryOptions) ([]*core.Schema, error) {
+	cluster, err := create_mysql_cluster(config)
+	if err != nil { return nil, err }
+
+	// Read the definitions from the primary, replicas may lag behind schema changes.
+	var tables []string
+	var columns map[string][]Column
+	err = cluster.write(func (db *sqlx.DB) error {
+		tables, columns, err = discover_mysql_columns(db, options)
+		return err
+	})
+	if err != nil { return nil, err }
+
+	if options != nil {
+		for _, t := range options.Tables {
+			if _, ok := columns[t]; !ok { return nil, fmt.Errorf("table \"%s\" not found", t) }
+		}
+	}
+
+	schemas := []*core.Schema{}
+	for _, table := range tables {
+		schema := &core.Schema{
+			Name: table,
+			Provider: create_mysql_data_provider(cluster, table, columns[table]),
+		}
+		for _, c := range columns[table] {
+			schema.Fields = append(schema.Fields, column_to_field(c))
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
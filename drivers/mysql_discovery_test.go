@@ -0,0 +1,120 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlTypeMapping (t *testing.T) {
+	cases := []struct {
+		data_type string
+		column_type string
+		expected ColType
+	}{
+		{ "int", "int", ColType_INT },
+		{ "bigint", "bigint unsigned", ColType_INT },
+		{ "tinyint", "tinyint(1)", ColType_BOOL },
+		{ "tinyint", "tinyint(4)", ColType_INT },
+		{ "bit", "bit(1)", ColType_BOOL },
+		{ "double", "double", ColType_FLOAT },
+		{ "decimal", "decimal(10,2)", ColType_DECIMAL },
+		{ "varchar", "varchar(255)", ColType_STRING },
+		{ "text", "text", ColType_STRING },
+		{ "date", "date", ColType_DATE },
+		{ "datetime", "datetime", ColType_DATETIME },
+		{ "timestamp", "timestamp", ColType_TIMESTAMP },
+		{ "json", "json", ColType_JSON },
+		{ "blob", "blob", ColType_BLOB },
+		{ "enum", "enum('a','b')", ColType_ENUM },
+	}
+	for _, c := range cases {
+		coltype, err := mysql_type_to_col_type(c.data_type, c.column_type)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, coltype, c.column_type)
+	}
+
+	_, err := mysql_type_to_col_type("geometry", "geometry")
+	assert.ErrorContains(t, err, "geometry")
+}
+
+func TestMysqlEnumValues (t *testing.T) {
+	assert.Equal(t, []string{ "small", "large" }, parse_enum_values("enum('small','large')"))
+	assert.Equal(t, []string{ "it's", "a,b" }, parse_enum_values("enum('it''s','a,b')"))
+	assert.Nil(t, parse_enum_values("enum"))
+}
+
+func TestMysqlInformationSchemaColumn (t *testing.T) {
+	column, err := information_schema_to_column(information_schema_column{
+		TableName: "Orders",
+		ColumnName: "status",
+		DataType: "enum",
+		ColumnType: "enum('open','closed')",
+		IsNullable: "YES",
+		ColumnKey: "",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Column{ Name: "status", Type: ColType_ENUM, Nullable: true, Values: []string{ "open", "closed" } }, column)
+
+	field := column_to_field(Column{ Name: "id", Type: ColType_INT, PrimaryKey: true })
+	assert.Equal(t, &core.Field{ Name: "id", Type: core.FieldType_INT, PrimaryKey: true }, field)
+}
+
+func TestMysqlSchemaDiscovery (t *testing.T) {
+	skip_without_mysql(t)
+	var dbname string = hash("test_database")
+	assert.NoError(t, setup_database(dbname))
+	defer func () { assert.NoError(t, cleanup_database(dbname)) }()
+
+	assert.NoError(t, execute_query(dbname, `CREATE TABLE users (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		location varchar(255)
+	)`))
+	assert.NoError(t, execute_query(dbname, `CREATE TABLE orders (
+		id int NOT NULL PRIMARY KEY,
+		user_id int NOT NULL,
+		total decimal(10,2) NOT NULL
+	)`))
+	assert.NoError(t, execute_query(dbname, `INSERT INTO users VALUES (1, 'John', 'Arizona'), (2, 'Jimmy', NULL)`))
+
+	config := &MysqlConfig{ Primary: MysqlConnectionString(dbname) }
+
+	t.Run("all tables", func (t *testing.T) {
+		schemas, err := DiscoverMysqlSchemas(config, nil)
+		assert.NoError(t, err)
+		assert.Len(t, schemas, 2)
+
+		res, err := core.EasyApiImpl(&core.Config{ Schemas: schemas })
+		assert.NoError(t, err)
+
+		route := core.GetRoute(res, "/api/users/findone")
+		assert.NotNil(t, route)
+		if route == nil { return }
+		res_opaque, err := route.Action("location=-null")
+		assert.NoError(t, err)
+		entry, ok := res_opaque.(*map[string]interface{})
+		assert.True(t, ok)
+		if entry == nil { return }
+		assert.Equal(t, int64(2), (*entry)["id"])
+		assert.Equal(t, "Jimmy", (*entry)["name"])
+	});
+
+	t.Run("filtered tables", func (t *testing.T) {
+		schemas, err := DiscoverMysqlSchemas(config, &MysqlDiscoveryOptions{ Tables: []string{ "orders" } })
+		assert.NoError(t, err)
+		assert.Len(t, schemas, 1)
+		if len(schemas) != 1 { return }
+
+		assert.Equal(t, "orders", schemas[0].Name)
+		assert.Equal(t, []string{ "id" }, schemas[0].PrimaryKey())
+		assert.Equal(t, core.FieldType_DECIMAL, schemas[0].Field("total").Type)
+		assert.False(t, schemas[0].Field("user_id").Nullable)
+	});
+
+	t.Run("missing table", func (t *testing.T) {
+		_, err := DiscoverMysqlSchemas(config, &MysqlDiscoveryOptions{ Tables: []string{ "missing" } })
+		assert.ErrorContains(t, err, "missing")
+	});
+}
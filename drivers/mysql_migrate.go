@@ -0,0 +1,359 @@
+package drivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/jmoiron/sqlx"
+)
+
+// A single schema change and the statement reverting it.
+type MigrationStep struct {
+	Up string
+	Down string
+}
+
+type Migration struct {
+	// Identifier of the migration in the history table.
+	Version string
+	Steps []MigrationStep
+}
+
+// Whether the migration has nothing to apply.
+func (m *Migration) Empty () bool {
+	return len(m.Steps) == 0
+}
+
+// The statements applying the migration.
+func (m *Migration) Script () string {
+	statements := []string{}
+	for _, step := range m.Steps {
+		statements = append(statements, step.Up + ";")
+	}
+	return strings.Join(statements, "\n")
+}
+
+// The statements reverting the migration, in the order they must be run.
+func (m *Migration) RollbackScript () string {
+	statements := []string{}
+	for i := len(m.Steps) - 1; i >= 0; i-- {
+		statements = append(statements, m.Steps[i].Down + ";")
+	}
+	return strings.Join(statements, "\n")
+}
+
+type MigrationRecord struct {
+	Migration
+	AppliedAt time.Time
+}
+
+type MysqlMigrationOptions struct {
+	// Name of the table recording the applied migrations.
+	// Default: "easyapi_migrations"
+	HistoryTable string
+}
+
+// Keeps MySQL tables in sync with the fields declared on `core.Schema`s.
+// Each schema maps to the table of the same name. Columns and tables that are
+// not declared are never dropped.
+type MysqlMigrator struct {
+	cluster *mysql_cluster
+	history_table string
+	now func() time.Time
+}
+
+func CreateMysqlMigrator (config *MysqlConfig, options *MysqlMigrationOptions) (*MysqlMigrator, error) {
+	cluster, err := create_mysql_cluster(config)
+	if err != nil { return nil, err }
+
+	m := &MysqlMigrator{
+		cluster: cluster,
+		history_table: "easyapi_migrations",
+		now: time.Now,
+	}
+	if options != nil && len(options.HistoryTable) > 0 { m.history_table = options.HistoryTable }
+	return m, nil
+}
+
+func field_type_to_sql_type (field *core.Field) (string, error) {
+	switch field.Type {
+	case core.FieldType_INT: return "int", nil
+	case core.FieldType_STRING: return "varchar(255)", nil
+	case core.FieldType_FLOAT: return "double", nil
+	case core.FieldType_DECIMAL: return "decimal(20,6)", nil
+	case core.FieldType_BOOL: return "tinyint(1)", nil
+	case core.FieldType_DATE: return "date", nil
+	case core.FieldType_DATETIME: return "datetime", nil
+	case core.FieldType_JSON: return "json", nil
+	case core.FieldType_BLOB: return "blob", nil
+	case core.FieldType_UUID: return "char(36)", nil
+	case core.FieldType_ENUM:
+		if len(field.Values) == 0 { return "", fmt.Errorf("enum field \"%s\" must declare its values", field.Name) }
+		values := []string{}
+		for _, v := range field.Values {
+			values = append(values, quote_string(v))
+		}
+		return fmt.Sprintf("enum(%s)", strings.Join(values, ",")), nil
+	}
+	return "", fmt.Errorf("conversion from field type %d to sql type not defined for field \"%s\"", field.Type, field.Name)
+}
+
+func null_clause (nullable bool) string {
+	if nullable { return "NULL" }
+	return "NOT NULL"
+}
+
+func field_column_definition (field *core.Field) (string, error) {
+	sqltype, err := field_type_to_sql_type(field)
+	if err != nil { return "", err }
+	return fmt.Sprintf("%s %s %s", quote_identifier(field.Name), sqltype, null_clause(field.Nullable)), nil
+}
+
+func quote_string (value string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(value, "\\", "\\\\"), "'", "''") + "'"
+}
+
+// The default, AUTO_INCREMENT, ON UPDATE and comment of a live column, which
+// a MODIFY COLUMN would drop if not repeated.
+func live_column_attributes (c information_schema_column) string {
+	attributes := ""
+	// Expression defaults are flagged in EXTRA and must not be quoted, nor
+	// CURRENT_TIMESTAMP which MySQL 5.7 does not flag.
+	expression := strings.Contains(strings.ToUpper(c.Extra), "DEFAULT_GENERATED")
+	if c.ColumnDefault.Valid {
+		if strings.HasPrefix(strings.ToUpper(c.ColumnDefault.String), "CURRENT_TIMESTAMP") {
+			attributes += " DEFAULT " + c.ColumnDefault.String
+		} else if expression {
+			attributes += fmt.Sprintf(" DEFAULT (%s)", c.ColumnDefault.String)
+		} else {
+			attributes += " DEFAULT " + quote_string(c.ColumnDefault.String)
+		}
+	}
+	extra := strings.TrimSpace(strings.Replace(c.Extra, "DEFAULT_GENERATED", "", 1))
+	// Generated columns hold an expression, they are not modified.
+	if len(extra) > 0 && !strings.Contains(strings.ToUpper(extra), "GENERATED") { attributes += " " + extra }
+	if len(c.ColumnComment) > 0 { attributes += " COMMENT " + quote_string(c.ColumnComment) }
+	return attributes
+}
+
+func live_column_definition (c information_schema_column) string {
+	return fmt.Sprintf("%s %s %s%s", quote_identifier(c.ColumnName), c.ColumnType, null_clause(strings.EqualFold(c.IsNullable, "YES")), live_column_attributes(c))
+}
+
+// Whether the live column already stores the declared field.
+func live_column_matches (field *core.Field, live information_schema_column) bool {
+	column, err := information_schema_to_column(live)
+	if err != nil { return false }
+	if col_type_to_field_type(column.Type) != field.Type { return false }
+	if column.Nullable != field.Nullable { return false }
+	if field.Type == core.FieldType_ENUM && strings.Join(column.Values, "\x00") != strings.Join(field.Values, "\x00") { return false }
+	return true
+}
+
+func quote_identifiers (names []string) string {
+	quoted := []string{}
+	for _, n := range names {
+		quoted = append(quoted, quote_identifier(n))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// Compute the steps bringing the live columns of `table` to the declared
+// `fields`. An empty `live` means the table does not exist.
+func plan_table_migration (table string, fields []*core.Field, live []information_schema_column) ([]MigrationStep, error) {
+	if len(fields) == 0 { return nil, fmt.Errorf("schema \"%s\" does not declare any field", table) }
+	quoted_table := quote_identifier(table)
+
+	primary_key := []string{}
+	for _, f := range fields {
+		if f.PrimaryKey { primary_key = append(primary_key, f.Name) }
+	}
+
+	if len(live) == 0 {
+		definitions := []string{}
+		for _, f := range fields {
+			definition, err := field_column_definition(f)
+			if err != nil { return nil, err }
+			definitions = append(definitions, definition)
+		}
+		if len(primary_key) > 0 {
+			definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", quote_identifiers(primary_key)))
+		}
+		return []MigrationStep{{
+			Up: fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", quoted_table, strings.Join(definitions, ",\n\t")),
+			Down: fmt.Sprintf("DROP TABLE %s", quoted_table),
+		}}, nil
+	}
+
+	live_columns := map[string]information_schema_column{}
+	live_primary_key := []string{}
+	for _, c := range live {
+		live_columns[c.ColumnName] = c
+		if strings.EqualFold(c.ColumnKey, "PRI") { live_primary_key = append(live_primary_key, c.ColumnName) }
+	}
+
+	steps := []MigrationStep{}
+	for _, f := range fields {
+		definition, err := field_column_definition(f)
+		if err != nil { return nil, err }
+
+		current, exists := live_columns[f.Name]
+		if !exists {
+			steps = append(steps, MigrationStep{
+				Up: fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quoted_table, definition),
+				Down: fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quoted_table, quote_identifier(f.Name)),
+			})
+		} else if !live_column_matches(f, current) {
+			steps = append(steps, MigrationStep{
+				Up: fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s%s", quoted_table, definition, live_column_attributes(current)),
+				Down: fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", quoted_table, live_column_definition(current)),
+			})
+		}
+	}
+
+	// The primary key is only changed when the schema declares one.
+	if len(primary_key) > 0 && strings.Join(primary_key, "\x00") != strings.Join(live_primary_key, "\x00") {
+		step := MigrationStep{
+			Up: fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", quoted_table, quote_identifiers(primary_key)),
+			Down: fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", quoted_table),
+		}
+		if len(live_primary_key) > 0 {
+			step.Up = fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (%s)", quoted_table, quote_identifiers(primary_key))
+			step.Down = fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (%s)", quoted_table, quote_identifiers(live_primary_key))
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Compare the declared fields of `schemas` with the live database and return
+// the migration reconciling them, without applying it.
+func (m *MysqlMigrator) Plan (schemas []*core.Schema) (*Migration, error) {
+	tables := []string{}
+	for _, s := range schemas {
+		tables = append(tables, s.Name)
+	}
+
+	var rows []information_schema_column
+	err := m.cluster.write(func (db *sqlx.DB) error {
+		var err error
+		rows, err = read_information_schema(db, tables)
+		return err
+	})
+	if err != nil { return nil, err }
+
+	live := map[string][]information_schema_column{}
+	for _, row := range rows {
+		live[row.TableName] = append(live[row.TableName], row)
+	}
+
+	migration := &Migration{ Version: m.now().UTC().Format("20060102150405.000000") }
+	for _, s := range schemas {
+		steps, err := plan_table_migration(s.Name, s.Fields, live[s.Name])
+		if err != nil { return nil, err }
+		migration.Steps = append(migration.Steps, steps...)
+	}
+	return migration, nil
+}
+
+func (m *MysqlMigrator) ensure_history_table (db *sqlx.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version varchar(32) NOT NULL PRIMARY KEY,
+		applied_at datetime(6) NOT NULL,
+		steps json NOT NULL
+	)`, quote_identifier(m.history_table)))
+	return err
+}
+
+// Apply the migration and record it in the history table. MySQL cannot roll
+// back schema changes in a transaction, so when a step fails, the steps that
+// were already applied are reverted before returning the error.
+func (m *MysqlMigrator) Apply (migration *Migration) error {
+	if migration.Empty() { return nil }
+
+	return m.cluster.write(func (db *sqlx.DB) error {
+		if err := m.ensure_history_table(db); err != nil { return err }
+
+		for i, step := range migration.Steps {
+			if _, err := db.Exec(step.Up); err != nil {
+				for j := i - 1; j >= 0; j-- {
+					if _, down_err := db.Exec(migration.Steps[j].Down); down_err != nil {
+						return fmt.Errorf("migration step \"%s\" failed: %w, and reverting \"%s\" failed: %s", step.Up, err, migration.Steps[j].Down, down_err)
+					}
+				}
+				return fmt.Errorf("migration step \"%s\" failed: %w", step.Up, err)
+			}
+		}
+
+		steps, err := json.Marshal(migration.Steps)
+		if err != nil { return err }
+		_, err = db.Exec(
+			fmt.Sprintf(`INSERT INTO %s (version, applied_at, steps) VALUES (?, ?, ?)`, quote_identifier(m.history_table)),
+			migration.Version, m.now().UTC().Format(_mysqlDatetimeLayout), string(steps))
+		return err
+	})
+}
+
+// Plan the migration for `schemas` and, unless `dry_run` is set, apply it.
+func (m *MysqlMigrator) Migrate (schemas []*core.Schema, dry_run bool) (*Migration, error) {
+	migration, err := m.Plan(schemas)
+	if err != nil { return nil, err }
+	if dry_run { return migration, nil }
+	return migration, m.Apply(migration)
+}
+
+// Return the applied migrations, oldest first.
+func (m *MysqlMigrator) History () ([]*MigrationRecord, error) {
+	records := []*MigrationRecord{}
+	err := m.cluster.write(func (db *sqlx.DB) error {
+		if err := m.ensure_history_table(db); err != nil { return err }
+
+		// Formatted by MySQL, the driver returns a time.Time instead of a
+		// string for datetime columns with the "parseTime" DSN option.
+		rows, err := db.Query(fmt.Sprintf(
+			`SELECT version, DATE_FORMAT(applied_at, '%%Y-%%m-%%d %%H:%%i:%%s.%%f'), steps FROM %s ORDER BY version`,
+			quote_identifier(m.history_table),
+		))
+		if err != nil { return err }
+		defer rows.Close()
+
+		for rows.Next() {
+			var version, applied_at, steps string
+			if err := rows.Scan(&version, &applied_at, &steps); err != nil { return err }
+
+			record := &MigrationRecord{}
+			record.Version = version
+			record.AppliedAt, err = time.Parse(_mysqlDatetimeLayout, applied_at)
+			if err != nil { return err }
+			if err := json.Unmarshal([]byte(steps), &record.Steps); err != nil { return err }
+			records = append(records, record)
+		}
+		return rows.Err()
+	})
+	if err != nil { return nil, err }
+	return records, nil
+}
+
+// Revert the most recently applied migration and remove it from the history.
+// Returns nil if no migration was applied.
+func (m *MysqlMigrator) Rollback () (*MigrationRecord, error) {
+	history, err := m.History()
+	if err != nil { return nil, err }
+	if len(history) == 0 { return nil, nil }
+	last := history[len(history) - 1]
+
+	err = m.cluster.write(func (db *sqlx.DB) error {
+		for i := len(last.Steps) - 1; i >= 0; i-- {
+			if _, err := db.Exec(last.Steps[i].Down); err != nil {
+				return fmt.Errorf("rollback step \"%s\" failed: %w", last.Steps[i].Down, err)
+			}
+		}
+		_, err := db.Exec(fmt.Sprintf(`DELETE FROM %s WHERE version = ?`, quote_identifier(m.history_table)), last.Version)
+		return err
+	})
+	if err != nil { return nil, err }
+	return last, nil
+}
@@ -0,0 +1,165 @@
+package drivers
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func user_fields () []*core.Field {
+	return []*core.Field{
+		{ Name: "id", Type: core.FieldType_INT, PrimaryKey: true },
+		{ Name: "name", Type: core.FieldType_STRING },
+		{ Name: "location", Type: core.FieldType_STRING, Nullable: true },
+	}
+}
+
+func TestMysqlMigrationPlan (t *testing.T) {
+	t.Run("create missing table", func (t *testing.T) {
+		steps, err := plan_table_migration("users", user_fields(), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []MigrationStep{{
+			Up: "CREATE TABLE `users` (\n\t`id` int NOT NULL,\n\t`name` varchar(255) NOT NULL,\n\t`location` varchar(255) NULL,\n\tPRIMARY KEY (`id`)\n)",
+			Down: "DROP TABLE `users`",
+		}}, steps)
+	});
+
+	t.Run("up to date table", func (t *testing.T) {
+		steps, err := plan_table_migration("users", user_fields(), []information_schema_column{
+			{ TableName: "users", ColumnName: "id", DataType: "int", ColumnType: "int", IsNullable: "NO", ColumnKey: "PRI" },
+			{ TableName: "users", ColumnName: "name", DataType: "varchar", ColumnType: "varchar(100)", IsNullable: "NO" },
+			{ TableName: "users", ColumnName: "location", DataType: "text", ColumnType: "text", IsNullable: "YES" },
+			{ TableName: "users", ColumnName: "legacy", DataType: "int", ColumnType: "int", IsNullable: "YES" },
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, steps)
+	});
+
+	t.Run("add and modify columns", func (t *testing.T) {
+		steps, err := plan_table_migration("users", user_fields(), []information_schema_column{
+			{ TableName: "users", ColumnName: "id", DataType: "int", ColumnType: "int", IsNullable: "NO", ColumnKey: "PRI" },
+			{ TableName: "users", ColumnName: "name", DataType: "varchar", ColumnType: "varchar(100)", IsNullable: "YES" },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []MigrationStep{
+			{
+				Up: "ALTER TABLE `users` MODIFY COLUMN `name` varchar(255) NOT NULL",
+				Down: "ALTER TABLE `users` MODIFY COLUMN `name` varchar(100) NULL",
+			}, {
+				Up: "ALTER TABLE `users` ADD COLUMN `location` varchar(255) NULL",
+				Down: "ALTER TABLE `users` DROP COLUMN `location`",
+			},
+		}, steps)
+	});
+
+	t.Run("modify keeps column attributes", func (t *testing.T) {
+		steps, err := plan_table_migration("users", user_fields(), []information_schema_column{
+			{ TableName: "users", ColumnName: "id", DataType: "int", ColumnType: "int", IsNullable: "YES", ColumnKey: "PRI", Extra: "auto_increment", ColumnComment: "the user's id" },
+			{ TableName: "users", ColumnName: "name", DataType: "varchar", ColumnType: "varchar(255)", IsNullable: "YES", ColumnDefault: sql.NullString{ String: "anonymous", Valid: true } },
+			{ TableName: "users", ColumnName: "location", DataType: "datetime", ColumnType: "datetime", IsNullable: "YES", ColumnDefault: sql.NullString{ String: "CURRENT_TIMESTAMP", Valid: true }, Extra: "DEFAULT_GENERATED on update CURRENT_TIMESTAMP" },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []MigrationStep{
+			{
+				Up: "ALTER TABLE `users` MODIFY COLUMN `id` int NOT NULL auto_increment COMMENT 'the user''s id'",
+				Down: "ALTER TABLE `users` MODIFY COLUMN `id` int NULL auto_increment COMMENT 'the user''s id'",
+			}, {
+				Up: "ALTER TABLE `users` MODIFY COLUMN `name` varchar(255) NOT NULL DEFAULT 'anonymous'",
+				Down: "ALTER TABLE `users` MODIFY COLUMN `name` varchar(255) NULL DEFAULT 'anonymous'",
+			}, {
+				Up: "ALTER TABLE `users` MODIFY COLUMN `location` varchar(255) NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP",
+				Down: "ALTER TABLE `users` MODIFY COLUMN `location` datetime NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP",
+			},
+		}, steps)
+	});
+
+	t.Run("primary key change", func (t *testing.T) {
+		steps, err := plan_table_migration("users", user_fields(), []information_schema_column{
+			{ TableName: "users", ColumnName: "id", DataType: "int", ColumnType: "int", IsNullable: "NO" },
+			{ TableName: "users", ColumnName: "name", DataType: "varchar", ColumnType: "varchar(255)", IsNullable: "NO", ColumnKey: "PRI" },
+			{ TableName: "users", ColumnName: "location", DataType: "varchar", ColumnType: "varchar(255)", IsNullable: "YES" },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []MigrationStep{{
+			Up: "ALTER TABLE `users` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`)",
+			Down: "ALTER TABLE `users` DROP PRIMARY KEY, ADD PRIMARY KEY (`name`)",
+		}}, steps)
+	});
+
+	t.Run("enum values change", func (t *testing.T) {
+		fields := []*core.Field{{ Name: "size", Type: core.FieldType_ENUM, Values: []string{ "small", "large" } }}
+		steps, err := plan_table_migration("items", fields, []information_schema_column{
+			{ TableName: "items", ColumnName: "size", DataType: "enum", ColumnType: "enum('small')", IsNullable: "NO" },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []MigrationStep{{
+			Up: "ALTER TABLE `items` MODIFY COLUMN `size` enum('small','large') NOT NULL",
+			Down: "ALTER TABLE `items` MODIFY COLUMN `size` enum('small') NOT NULL",
+		}}, steps)
+	});
+
+	t.Run("invalid fields", func (t *testing.T) {
+		_, err := plan_table_migration("items", nil, nil)
+		assert.Error(t, err)
+		_, err = plan_table_migration("items", []*core.Field{{ Name: "size", Type: core.FieldType_ENUM }}, nil)
+		assert.ErrorContains(t, err, "size")
+	});
+
+	t.Run("scripts", func (t *testing.T) {
+		migration := &Migration{ Steps: []MigrationStep{
+			{ Up: "CREATE TABLE a (id int)", Down: "DROP TABLE a" },
+			{ Up: "CREATE TABLE b (id int)", Down: "DROP TABLE b" },
+		}}
+		assert.Equal(t, "CREATE TABLE a (id int);\nCREATE TABLE b (id int);", migration.Script())
+		assert.Equal(t, "DROP TABLE b;\nDROP TABLE a;", migration.RollbackScript())
+	});
+}
+
+func TestMysqlMigrator (t *testing.T) {
+	skip_without_mysql(t)
+	var dbname string = hash("test_database")
+	assert.NoError(t, setup_database(dbname))
+	defer func () { assert.NoError(t, cleanup_database(dbname)) }()
+
+	migrator, err := CreateMysqlMigrator(&MysqlConfig{ Primary: MysqlConnectionString(dbname) }, nil)
+	require.NoError(t, err)
+
+	schemas := []*core.Schema{{ Name: "users", Fields: user_fields() }}
+
+	// Dry run does not touch the database.
+	migration, err := migrator.Migrate(schemas, true)
+	require.NoError(t, err)
+	assert.Len(t, migration.Steps, 1)
+	history, err := migrator.History()
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	migration, err = migrator.Migrate(schemas, false)
+	require.NoError(t, err)
+	assert.Len(t, migration.Steps, 1)
+
+	// The table is now up to date.
+	migration, err = migrator.Migrate(schemas, true)
+	require.NoError(t, err)
+	assert.True(t, migration.Empty())
+
+	schemas[0].Fields = append(schemas[0].Fields, &core.Field{ Name: "age", Type: core.FieldType_INT, Nullable: true })
+	migration, err = migrator.Migrate(schemas, false)
+	require.NoError(t, err)
+	assert.Len(t, migration.Steps, 1)
+
+	history, err = migrator.History()
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	rolled_back, err := migrator.Rollback()
+	require.NoError(t, err)
+	assert.Equal(t, migration.Version, rolled_back.Version)
+
+	migration, err = migrator.Migrate(schemas, true)
+	require.NoError(t, err)
+	assert.Equal(t, "ALTER TABLE `users` ADD COLUMN `age` int NULL", migration.Steps[0].Up)
+}
@@ -0,0 +1,91 @@
+package drivers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/jmoiron/sqlx"
+)
+
+// Column holding the relevance of the search results, dropped from the entries.
+const _searchRelevanceColumn = "easyapi_relevance"
+
+// Escape the LIKE wildcards of `s`.
+func escape_like (s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Build the search query of `query`. With a FULLTEXT index over the searched
+// fields, entries are matched and ranked by MATCH ... AGAINST. Otherwise an
+// entry matches when a searched field contains one of the words, and is
+// ranked by the number of (field, word) pairs that match.
+func search_query_to_sql (table string, columns []Column, query *core.SearchQuery, fulltext bool) (string, []interface{}, error) {
+	searched := []string{}
+	for _, field := range query.Fields {
+		column, err := find_column(columns, field)
+		if err != nil { return "", nil, err }
+		searched = append(searched, quote_identifier(column.Name))
+	}
+	if len(searched) == 0 { return "", nil, fmt.Errorf("at least one searched field is required") }
+
+	clauses, clause_args, err := constraints_to_sql_clauses(query.Constraints, columns)
+	if err != nil { return "", nil, err }
+
+	var match, relevance string
+	var match_args, relevance_args []interface{}
+	if fulltext {
+		match = fmt.Sprintf("MATCH(%s) AGAINST (? IN NATURAL LANGUAGE MODE)", strings.Join(searched, ","))
+		relevance = match
+		match_args = []interface{}{ query.Text }
+		relevance_args = match_args
+	} else {
+		likes := []string{}
+		for _, word := range core.Tokenize(query.Text) {
+			pattern := "%" + escape_like(word) + "%"
+			for _, field := range searched {
+				likes = append(likes, fmt.Sprintf("%s LIKE ?", field))
+				match_args = append(match_args, pattern)
+			}
+		}
+		if len(likes) == 0 { return "", nil, fmt.Errorf("search text must hold at least one word") }
+		match = fmt.Sprintf("(%s)", strings.Join(likes, " OR "))
+		relevance = fmt.Sprintf("((%s))", strings.Join(likes, ") + ("))
+		relevance_args = match_args
+	}
+
+	args := []interface{}{}
+	args = append(args, relevance_args...)
+	args = append(args, match_args...)
+	args = append(args, clause_args...)
+	sql := fmt.Sprintf(
+		"SELECT %s, %s AS %s FROM %s WHERE %s",
+		strings.Join(column_field_names(columns), ","),
+		relevance,
+		quote_identifier(_searchRelevanceColumn),
+		quote_identifier(table),
+		strings.Join(append([]string{ match }, clauses...), " AND "),
+	)
+	sql += fmt.Sprintf(" ORDER BY %s DESC LIMIT %d OFFSET %d", quote_identifier(_searchRelevanceColumn), query.Count, query.Offset)
+	return sql, args, nil
+}
+
+func mysql_search (db *sqlx.DB, table string, columns []Column, query *core.SearchQuery, fulltext bool) ([]map[string]interface{}, error) {
+	sql, args, err := search_query_to_sql(table, columns, query, fulltext)
+	if err != nil { return nil, err }
+
+	rows, err := db.Queryx(sql, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	entries := []map[string]interface{}{}
+	for rows.Next() {
+		entry := map[string]interface{}{}
+		if err := rows.MapScan(entry); err != nil { return nil, err }
+		delete(entry, _searchRelevanceColumn)
+		entry, err = fix_payload_types(entry, columns)
+		if err != nil { return nil, err }
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,49 @@
+package drivers
+
+import (
+	"testing"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlSearchQuery (t *testing.T) {
+	columns := []Column{
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "location", Type: ColType_STRING },
+	}
+	query := &core.SearchQuery{
+		Text: "Arizona 100%",
+		Fields: []string{ "name", "location" },
+		Constraints: []core.Constraint{{ Property: "name", Value: "John", Comparison: core.Comparison_NE }},
+		Offset: 0,
+		Count: 10,
+	}
+
+	t.Run("fulltext", func (t *testing.T) {
+		sql, args, err := search_query_to_sql("Users", columns, query, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT `name`,`location`, MATCH(`name`,`location`) AGAINST (? IN NATURAL LANGUAGE MODE) AS `easyapi_relevance` FROM `Users` WHERE MATCH(`name`,`location`) AGAINST (? IN NATURAL LANGUAGE MODE) AND NOT (`name` <=> ?) ORDER BY `easyapi_relevance` DESC LIMIT 10 OFFSET 0", sql)
+		assert.Equal(t, []interface{}{ "Arizona 100%", "Arizona 100%", "John" }, args)
+	});
+
+	t.Run("like fallback", func (t *testing.T) {
+		sql, args, err := search_query_to_sql("Users", columns, query, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT `name`,`location`, ((`name` LIKE ?) + (`location` LIKE ?) + (`name` LIKE ?) + (`location` LIKE ?)) AS `easyapi_relevance` FROM `Users` WHERE (`name` LIKE ? OR `location` LIKE ? OR `name` LIKE ? OR `location` LIKE ?) AND NOT (`name` <=> ?) ORDER BY `easyapi_relevance` DESC LIMIT 10 OFFSET 0", sql)
+		assert.Equal(t, []interface{}{
+			"%arizona%", "%arizona%", "%100%", "%100%",
+			"%arizona%", "%arizona%", "%100%", "%100%",
+			"John",
+		}, args)
+	});
+
+	t.Run("like wildcards are escaped", func (t *testing.T) {
+		assert.Equal(t, `50\%\_off\\`, escape_like(`50%_off\`))
+	});
+
+	t.Run("unknown field", func (t *testing.T) {
+		_, _, err := search_query_to_sql("Users", columns, &core.SearchQuery{ Text: "a", Fields: []string{ "bio" } }, false)
+		assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+	});
+}
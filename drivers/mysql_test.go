@@ -40,6 +40,16 @@ func hash (dbname string) string {
 	return fmt.Sprintf("%s_%s", dbname, generateRandomString(6))
 }
 
+// Skip the test when no MySQL server is reachable.
+func skip_without_mysql (t *testing.T) {
+	db, err := sql.Open("mysql", MysqlConnectionString(""))
+	if err == nil {
+		defer db.Close()
+		err = db.Ping()
+	}
+	if err != nil { t.Skipf("no mysql server: %s", err) }
+}
+
 // Create a database with the given `database_name`
 func setup_database (database_name string) error {
 	db, err := sql.Open("mysql", MysqlConnectionString(""))
@@ -94,55 +104,25 @@ func GenerateTestUserPayload (ct int) []map[string]interface{} {
 }
 
 
-func bulk_insert_query_creator (table string, columns []Column, payload []map[string]interface{}) (string, error) {
-	if len(columns) == 0 {
-		return "", fmt.Errorf("must be at least 1 entry in the columns")
-	}
-
-	column_names := []string{}
-	for _, c:= range columns {
-		column_names = append(column_names, c.Name)
-	}
-
-	values := []string{}
-	for _, entry := range payload {
-		curr_values := []string{}
-		for _, column := range columns {
-			value, exists := entry[column.Name]
-			if !exists {
-				return "", fmt.Errorf(fmt.Sprintf("entry in payload does not have value for field: \"%s\"", column.Name))
-			}
-
-			string_value, ok := value.(string)
-			if !ok {
-				return "", fmt.Errorf(fmt.Sprintf("expected entry for column \"%s\" to be a string", column.Name))
-			}
+// Insert the `payload` into `table` with the statements built by the provider.
+func bulk_insert (dbname, table string, columns []Column, payload []map[string]interface{}) error {
+	statements, err := bulk_insert_statements(table, columns, payload, 0)
+	if err != nil { return err }
 
-			switch column.Type {
-				case ColType_INT: // Nothing needs to be done.
-					// string_value = string_value
-					break
-				case ColType_STRING:
-					string_value = fmt.Sprintf("\"%s\"", string_value)
-					break
-				default:
-					return "", fmt.Errorf("Undefined column type")
-			}
+	db, err := sql.Open("mysql", MysqlConnectionString(dbname))
+	if err != nil { return err }
+	defer db.Close()
 
-			curr_values = append(curr_values, string_value)
-		}
-		values = append(values, fmt.Sprintf("(%s)", strings.Join(curr_values, ",")))
+	for _, statement := range statements {
+		if _, err := db.Exec(statement.query, statement.args...); err != nil { return err }
 	}
-
-	return fmt.Sprintf(`INSERT INTO %s (%s)
-		VALUES %s
-	`, table, strings.Join(column_names, ","), strings.Join(values, ",\n\t")), nil
-	
+	return nil
 }
 
 //////////////////////////////////////////////////////////////////////////
 
 func TestMysqlSetup (t *testing.T) {
+	skip_without_mysql(t)
 	t.Run("database setup and teardown", func (t *testing.T) {
 		var dbname string = hash("example_database")
 		assert.NoError(t, setup_database(dbname))
@@ -177,9 +157,7 @@ func TestMysqlSetup (t *testing.T) {
 		}
 		payload := GenerateTestUserPayload(3)
 
-		insert_query, error := bulk_insert_query_creator("Users", columns, payload)
-		assert.NoError(t, error, fmt.Sprintf("Insert query creation failed: %s", insert_query))
-		assert.NoError(t, execute_query(dbname, insert_query), fmt.Sprintf("Insert query failed: %s", insert_query))
+		assert.NoError(t, bulk_insert(dbname, "Users", columns, payload))
 	});
 	t.Run("bulk insertion large", func (t *testing.T) {
 		var dbname string = hash("example_database")
@@ -198,9 +176,7 @@ func TestMysqlSetup (t *testing.T) {
 		}
 		payload := GenerateTestUserPayload(100)
 
-		insert_query, error := bulk_insert_query_creator("Users", columns, payload)
-		assert.NoError(t, error, fmt.Sprintf("Insert query creation failed: %s", insert_query))
-		assert.NoError(t, execute_query(dbname, insert_query), fmt.Sprintf("Insert query failed: %s", insert_query))
+		assert.NoError(t, bulk_insert(dbname, "Users", columns, payload))
 	});
 }
 
@@ -222,6 +198,8 @@ func create_table_from_schema (dbname, tablename string, schema []*core.TestSche
 		sqltype, err := schema_type_to_sql_type(s.FieldType)
 		if err != nil { return err }
 		field_info := fmt.Sprintf(`%s %s`, s.FieldName, sqltype)
+		if !s.Nullable { field_info += " NOT NULL" }
+		if s.Unique { field_info += " UNIQUE" }
 
 		field_parts = append(field_parts, field_info)
 	}
@@ -244,65 +222,173 @@ func schema_type_to_col_type (schematype core.TestSchemaFieldType) (ColType, err
 
 type MysqlTestUnitContext struct {
 	DatabaseName string
+	// Number of tables created by the data provider creator.
+	Tables int
+}
+
+func setup_mysql_test_unit (t *testing.T, ctx *interface{}) error {
+	var dbname string = hash("test_database")
+	*ctx = &MysqlTestUnitContext{
+		DatabaseName: dbname,
+	}
+	// Database setup
+	assert.NoError(t, setup_database(dbname))
+	fmt.Printf("Database setup: %s\n", dbname)
+	return nil
+}
+
+func teardown_mysql_test_unit (t *testing.T, ctx *interface{}) error {
+	mysql_ctx, ok := (*ctx).(*MysqlTestUnitContext)
+	if !ok {  return fmt.Errorf("data provider test context is not defined") }
+
+	assert.NoError(t, cleanup_database(mysql_ctx.DatabaseName))
+	fmt.Printf("Database cleaned up: %s\n", mysql_ctx.DatabaseName)
+	return nil
+}
+
+// Return a data provider creator for the conformance tests which seeds the
+// test database and connects to it with the config returned by `config_fn`.
+func mysql_test_provider_creator (config_fn func(dbname string) *MysqlConfig) func (
+	t *testing.T,
+	schema []*core.TestSchemaDefinition,
+	payload []map[string]interface{},
+	opaq *interface{}) *core.DataProvider {
+	return func (
+		t *testing.T,
+		schema []*core.TestSchemaDefinition,
+		payload []map[string]interface{},
+		opaq *interface{}) *core.DataProvider {
+			fmt.Printf("Fetching mysql data\n")
+
+			mysql_ctx, ok := (*opaq).(*MysqlTestUnitContext)
+			assert.True(t, ok, "mysql context not provided")
+
+			var dbname string = mysql_ctx.DatabaseName
+
+			// Table creation based on schema
+			var tablename string = "Users"
+			if mysql_ctx.Tables > 0 { tablename = fmt.Sprintf("Users%d", mysql_ctx.Tables) }
+			mysql_ctx.Tables++
+			assert.NoError(t, create_table_from_schema(dbname, tablename, schema));
+
+			// Insert the data payload into the sql table
+			columns := []Column{}
+			for _, s := range schema {
+				coltype, err := schema_type_to_col_type(s.FieldType)
+				assert.NoError(t, err, "Failed to convert schema type to column type")
+				if err != nil { return nil }
+
+				col := Column {}
+				col.Name = s.FieldName
+				col.Type = coltype
+				col.Nullable = s.Nullable
+
+				columns = append(columns, col)
+			}
+			assert.NoError(t, bulk_insert(dbname, tablename, columns, payload))
+
+			// Create the data driver for accessing the newly inserted data from mysql
+			mysql_dataprovider, err := CreateMysqlDataProvider(config_fn(dbname), tablename, columns)
+			assert.NoError(t, err)
+			return mysql_dataprovider
+	}
 }
 
 func TestMysqlDataProvider (t *testing.T) {
+	skip_without_mysql(t)
+	core.SetupDataProviderTests(
+		t,
+		setup_mysql_test_unit,
+		teardown_mysql_test_unit,
+		mysql_test_provider_creator(func (dbname string) *MysqlConfig {
+			return &MysqlConfig{
+				PrimaryConnection: &MysqlConnection{
+					User: _DB_USER,
+					Password: _DB_PASS,
+					Database: dbname,
+				},
+			}
+		}),
+	)
+}
+
+func TestMysqlDataProviderWithReplicas (t *testing.T) {
+	skip_without_mysql(t)
+	// The replicas point at the same database as the primary so that every
+	// read, whichever node serves it, sees the seeded data.
 	core.SetupDataProviderTests(
 		t,
-		func (t *testing.T, ctx *interface{}) error {
-			var dbname string = hash("test_database")
-			*ctx = &MysqlTestUnitContext{
-				DatabaseName: dbname,
+		setup_mysql_test_unit,
+		teardown_mysql_test_unit,
+		mysql_test_provider_creator(func (dbname string) *MysqlConfig {
+			return &MysqlConfig{
+				Primary: MysqlConnectionString(dbname),
+				Replicas: []string{ MysqlConnectionString(dbname), MysqlConnectionString(dbname) },
+				ReplicaSelection: ReplicaSelection_LEAST_CONNECTIONS,
 			}
-			// Database setup
-			assert.NoError(t, setup_database(dbname))
-			fmt.Printf("Database setup: %s\n", dbname)
-			return nil
-		},
-		func (t *testing.T, ctx *interface{}) error {
-			mysql_ctx, ok := (*ctx).(*MysqlTestUnitContext)
-			if !ok {  return fmt.Errorf("data provider test context is not defined") }
-
-			assert.NoError(t, cleanup_database(mysql_ctx.DatabaseName))
-			fmt.Printf("Database cleaned up: %s\n", mysql_ctx.DatabaseName)
-			return nil
-		},
-		func (
-			t *testing.T,
-			schema []*core.TestSchemaDefinition,
-			payload []map[string]interface{},
-			opaq *interface{}) *core.DataProvider {
-				fmt.Printf("Fetching mysql data\n")
-
-				mysql_ctx, ok := (*opaq).(*MysqlTestUnitContext)
-				assert.True(t, ok, "mysql context not provided")
-
-				var dbname string = mysql_ctx.DatabaseName
-
-				// Table creation based on schema
-				var tablename string = "Users"
-				assert.NoError(t, create_table_from_schema(dbname, tablename, schema));
-
-				// Insert the data payload into the sql table
-				columns := []Column{}
-				for _, s := range schema {
-					coltype, err := schema_type_to_col_type(s.FieldType)
-					assert.NoError(t, err, "Failed to convert schema type to column type")
-					if err != nil { return nil }
-
-					col := Column {}
-					col.Name = s.FieldName
-					col.Type = coltype
-
-					columns = append(columns, col)
-				}
-				insert_query, error := bulk_insert_query_creator(tablename, columns, payload)
-				assert.NoError(t, error)
-				assert.NoError(t, execute_query(dbname, insert_query), fmt.Sprintf("Insert query failed: %s", insert_query))
-
-				// Create the data driver for accessing the newly inserted data from mysql
-				mysql_dataprovider, err := CreateMysqlDataProvider(_DB_USER, _DB_PASS, dbname, tablename, columns)
-				assert.NoError(t, err)
-				return mysql_dataprovider
+		}),
+	)
+}
+
+func TestMysqlColumnTypes (t *testing.T) {
+	skip_without_mysql(t)
+	var dbname string = hash("test_database")
+	assert.NoError(t, setup_database(dbname))
+	defer func () { assert.NoError(t, cleanup_database(dbname)) }()
+
+	table_sql := `CREATE TABLE Items (
+		id int,
+		price decimal(10,2),
+		weight double,
+		available tinyint(1),
+		released date,
+		updated_at datetime,
+		attributes json,
+		thumbnail blob,
+		uid char(36),
+		size enum('small','large')
+	)`
+	assert.NoError(t, execute_query(dbname, table_sql))
+	assert.NoError(t, execute_query(dbname, `INSERT INTO Items VALUES
+		(1, 19.99, 1.25, 1, '2023-10-01', '2023-10-01 12:30:45', '{"color":"red"}', X'0001', '123e4567-e89b-12d3-a456-426614174000', 'large')`))
+
+	columns := []Column{
+		{ Name: "id", Type: ColType_INT },
+		{ Name: "price", Type: ColType_DECIMAL },
+		{ Name: "weight", Type: ColType_FLOAT },
+		{ Name: "available", Type: ColType_BOOL },
+		{ Name: "released", Type: ColType_DATE },
+		{ Name: "updated_at", Type: ColType_DATETIME },
+		{ Name: "attributes", Type: ColType_JSON },
+		{ Name: "thumbnail", Type: ColType_BLOB },
+		{ Name: "uid", Type: ColType_UUID },
+		{ Name: "size", Type: ColType_ENUM, Values: []string{ "small", "large" } },
+	}
+	provider, err := CreateMysqlDataProvider(&MysqlConfig{ Primary: MysqlConnectionString(dbname) }, "Items", columns)
+	assert.NoError(t, err)
+
+	check := func (entry map[string]interface{}) {
+		assert.Equal(t, int64(1), entry["id"])
+		assert.Equal(t, "19.99", fmt.Sprint(entry["price"]))
+		assert.Equal(t, 1.25, entry["weight"])
+		assert.Equal(t, true, entry["available"])
+		assert.Equal(t, "2023-10-01", entry["released"])
+		assert.Equal(t, time.Date(2023, 10, 1, 12, 30, 45, 0, time.UTC), entry["updated_at"])
+		assert.Equal(t, map[string]interface{}{ "color": "red" }, entry["attributes"])
+		assert.Equal(t, "AAE=", entry["thumbnail"])
+		assert.Equal(t, "123e4567-e89b-12d3-a456-426614174000", entry["uid"])
+		assert.Equal(t, "large", entry["size"])
+	}
+
+	entries, err := provider.All(0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	if len(entries) == 1 { check(entries[0]) }
+
+	entry, err := provider.FindOne([]core.Constraint{
+		{ Property: "id", Value: "1", Comparison: core.Comparison_EQ },
+		{ Property: "available", Value: "true", Comparison: core.Comparison_EQ },
 	})
-}
\ No newline at end of file
+	assert.NoError(t, err)
+	if entry != nil { check(*entry) }
+}
@@ -0,0 +1,168 @@
+package drivers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_mysqlDateLayout = "2006-01-02"
+	_mysqlDatetimeLayout = "2006-01-02 15:04:05.999999"
+)
+
+func format_uuid (b []byte) string {
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+}
+
+func uuid_bytes (value string) ([]byte, error) {
+	stripped := strings.ReplaceAll(value, "-", "")
+	if len(stripped) != 32 { return nil, fmt.Errorf("invalid uuid \"%s\"", value) }
+	b, err := hex.DecodeString(stripped)
+	if err != nil { return nil, fmt.Errorf("invalid uuid \"%s\"", value) }
+	return b, nil
+}
+
+func parse_uuid (value string) (string, error) {
+	b, err := uuid_bytes(value)
+	if err != nil { return "", err }
+	return format_uuid(b), nil
+}
+
+func parse_datetime (value string) (time.Time, error) {
+	for _, layout := range []string{ _mysqlDatetimeLayout, time.RFC3339Nano, _mysqlDateLayout } {
+		t, err := time.Parse(layout, value)
+		if err == nil { return t, nil }
+	}
+	return time.Time{}, fmt.Errorf("invalid datetime \"%s\"", value)
+}
+
+func check_enum_value (value string, column Column) error {
+	if len(column.Values) == 0 { return nil }
+	for _, v := range column.Values {
+		if v == value { return nil }
+	}
+	return fmt.Errorf("value \"%s\" is not one of the allowed values of column \"%s\": %s", value, column.Name, strings.Join(column.Values, ", "))
+}
+
+// Decode a value scanned from MySQL into the go value served for `column`.
+// Text protocol results (plain queries) arrive as `[]byte`, while binary
+// protocol results (prepared statements) arrive as native go values.
+func decode_column_value (value interface{}, column Column) (interface{}, error) {
+	switch v := value.(type) {
+	case []byte:
+		return decode_column_bytes(v, column)
+	case string:
+		return decode_column_bytes([]byte(v), column)
+	case int64:
+		switch column.Type {
+		case ColType_INT: return v, nil
+		case ColType_FLOAT: return float64(v), nil
+		case ColType_DECIMAL: return json.Number(strconv.FormatInt(v, 10)), nil
+		case ColType_BOOL: return v != 0, nil
+		}
+	case float32:
+		switch column.Type {
+		// The shortest representation of the float32, as the text protocol
+		// serves it, e.g. 1.1 rather than 1.100000023841858.
+		case ColType_FLOAT: return strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+		case ColType_DECIMAL: return json.Number(strconv.FormatFloat(float64(v), 'f', -1, 32)), nil
+		}
+	case float64:
+		switch column.Type {
+		case ColType_FLOAT: return v, nil
+		case ColType_DECIMAL: return json.Number(strconv.FormatFloat(v, 'f', -1, 64)), nil
+		}
+	case time.Time:
+		switch column.Type {
+		case ColType_DATE: return v.Format(_mysqlDateLayout), nil
+		case ColType_DATETIME, ColType_TIMESTAMP: return v, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot decode %T value for column \"%s\" of type %d", value, column.Name, column.Type)
+}
+
+func decode_column_bytes (b []byte, column Column) (interface{}, error) {
+	s := string(b)
+	switch column.Type {
+	case ColType_INT:
+		return strconv.ParseInt(s, 10, 64)
+	case ColType_STRING:
+		return s, nil
+	case ColType_FLOAT:
+		return strconv.ParseFloat(s, 64)
+	case ColType_DECIMAL:
+		if _, err := strconv.ParseFloat(s, 64); err != nil { return nil, fmt.Errorf("invalid decimal \"%s\" in column \"%s\"", s, column.Name) }
+		return json.Number(s), nil
+	case ColType_BOOL:
+		if len(b) == 1 && b[0] <= 1 { return b[0] == 1, nil } // BIT(1)
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil { return strconv.ParseBool(s) }
+		return i != 0, nil
+	case ColType_DATE:
+		t, err := time.Parse(_mysqlDateLayout, s)
+		if err != nil { return nil, err }
+		return t.Format(_mysqlDateLayout), nil
+	case ColType_DATETIME, ColType_TIMESTAMP:
+		return time.Parse(_mysqlDatetimeLayout, s)
+	case ColType_JSON:
+		var decoded interface{}
+		if err := json.Unmarshal(b, &decoded); err != nil { return nil, err }
+		return decoded, nil
+	case ColType_BLOB:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case ColType_UUID:
+		if len(b) == 16 { return format_uuid(b), nil } // BINARY(16)
+		return parse_uuid(s)
+	case ColType_ENUM:
+		if err := check_enum_value(s, column); err != nil { return nil, err }
+		return s, nil
+	}
+	return nil, fmt.Errorf("decoding unimplemented for column type: %d", column.Type)
+}
+
+// Convert a constraint value, as received in the url, into the argument
+// bound to the query placeholder for `column`.
+func encode_column_value (value string, column Column) (interface{}, error) {
+	switch column.Type {
+	case ColType_INT:
+		return strconv.ParseInt(value, 10, 64)
+	case ColType_STRING:
+		return value, nil
+	case ColType_FLOAT:
+		return strconv.ParseFloat(value, 64)
+	case ColType_DECIMAL:
+		if _, err := strconv.ParseFloat(value, 64); err != nil { return nil, fmt.Errorf("invalid decimal \"%s\"", value) }
+		return value, nil
+	case ColType_BOOL:
+		b, err := strconv.ParseBool(value)
+		if err != nil { return nil, err }
+		if b { return 1, nil }
+		return 0, nil
+	case ColType_DATE:
+		t, err := time.Parse(_mysqlDateLayout, value)
+		if err != nil { return nil, err }
+		return t.Format(_mysqlDateLayout), nil
+	case ColType_DATETIME, ColType_TIMESTAMP:
+		t, err := parse_datetime(value)
+		if err != nil { return nil, err }
+		return t.UTC().Format(_mysqlDatetimeLayout), nil
+	case ColType_JSON:
+		if !json.Valid([]byte(value)) { return nil, fmt.Errorf("invalid json \"%s\"", value) }
+		return value, nil
+	case ColType_BLOB:
+		return base64.StdEncoding.DecodeString(value)
+	case ColType_UUID:
+		if column.Binary { return uuid_bytes(value) }
+		return parse_uuid(value)
+	case ColType_ENUM:
+		if err := check_enum_value(value, column); err != nil { return nil, err }
+		return value, nil
+	}
+	return nil, fmt.Errorf("encoding unimplemented for column type: %d", column.Type)
+}
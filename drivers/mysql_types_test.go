@@ -0,0 +1,170 @@
+package drivers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlColumnDecoding (t *testing.T) {
+	t.Run("text protocol", func (t *testing.T) {
+		cases := []struct {
+			column Column
+			raw string
+			expected interface{}
+		}{
+			{ Column{ Name: "a", Type: ColType_INT }, "42", int64(42) },
+			{ Column{ Name: "a", Type: ColType_INT }, "-7", int64(-7) },
+			{ Column{ Name: "a", Type: ColType_STRING }, "hello", "hello" },
+			{ Column{ Name: "a", Type: ColType_FLOAT }, "1.5", 1.5 },
+			{ Column{ Name: "a", Type: ColType_DECIMAL }, "12345678901234567890.12", json.Number("12345678901234567890.12") },
+			{ Column{ Name: "a", Type: ColType_BOOL }, "1", true },
+			{ Column{ Name: "a", Type: ColType_BOOL }, "0", false },
+			{ Column{ Name: "a", Type: ColType_DATE }, "2023-10-01", "2023-10-01" },
+			{ Column{ Name: "a", Type: ColType_DATETIME }, "2023-10-01 12:30:45", time.Date(2023, 10, 1, 12, 30, 45, 0, time.UTC) },
+			{ Column{ Name: "a", Type: ColType_TIMESTAMP }, "2023-10-01 12:30:45.123456", time.Date(2023, 10, 1, 12, 30, 45, 123456000, time.UTC) },
+			{ Column{ Name: "a", Type: ColType_JSON }, `{"tags":["a","b"]}`, map[string]interface{}{ "tags": []interface{}{ "a", "b" } } },
+			{ Column{ Name: "a", Type: ColType_BLOB }, "\x00\x01binary", "AAFiaW5hcnk=" },
+			{ Column{ Name: "a", Type: ColType_UUID }, "123E4567-E89B-12D3-A456-426614174000", "123e4567-e89b-12d3-a456-426614174000" },
+			{ Column{ Name: "a", Type: ColType_ENUM, Values: []string{ "small", "large" } }, "large", "large" },
+		}
+		for _, c := range cases {
+			value, err := decode_column_value([]byte(c.raw), c.column)
+			assert.NoError(t, err, "column type %d", c.column.Type)
+			assert.Equal(t, c.expected, value, "column type %d", c.column.Type)
+		}
+	});
+
+	t.Run("short integers do not panic", func (t *testing.T) {
+		value, err := decode_column_value([]byte("7"), Column{ Name: "a", Type: ColType_INT })
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), value)
+	});
+
+	t.Run("binary protocol", func (t *testing.T) {
+		value, err := decode_column_value(int64(3), Column{ Name: "a", Type: ColType_INT })
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), value)
+
+		value, err = decode_column_value(int64(1), Column{ Name: "a", Type: ColType_BOOL })
+		assert.NoError(t, err)
+		assert.Equal(t, true, value)
+
+		value, err = decode_column_value(float32(1.1), Column{ Name: "a", Type: ColType_FLOAT })
+		assert.NoError(t, err)
+		assert.Equal(t, 1.1, value)
+
+		when := time.Date(2023, 10, 1, 12, 30, 45, 0, time.UTC)
+		value, err = decode_column_value(when, Column{ Name: "a", Type: ColType_DATETIME })
+		assert.NoError(t, err)
+		assert.Equal(t, when, value)
+
+		value, err = decode_column_value(when, Column{ Name: "a", Type: ColType_DATE })
+		assert.NoError(t, err)
+		assert.Equal(t, "2023-10-01", value)
+
+		uuid := []byte{ 0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00 }
+		value, err = decode_column_value(uuid, Column{ Name: "a", Type: ColType_UUID })
+		assert.NoError(t, err)
+		assert.Equal(t, "123e4567-e89b-12d3-a456-426614174000", value)
+	});
+
+	t.Run("invalid values", func (t *testing.T) {
+		_, err := decode_column_value([]byte("abc"), Column{ Name: "a", Type: ColType_INT })
+		assert.Error(t, err)
+		_, err = decode_column_value([]byte("medium"), Column{ Name: "a", Type: ColType_ENUM, Values: []string{ "small", "large" } })
+		assert.Error(t, err)
+		_, err = decode_column_value(int64(1), Column{ Name: "a", Type: ColType_STRING })
+		assert.Error(t, err)
+	});
+}
+
+func TestMysqlConstraintClauses (t *testing.T) {
+	columns := []Column{
+		{ Name: "age", Type: ColType_INT },
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "active", Type: ColType_BOOL },
+		{ Name: "created_at", Type: ColType_DATETIME },
+	}
+
+	t.Run("binary uuids", func (t *testing.T) {
+		uuid := []byte{ 0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00 }
+		_, args, err := constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "id", Value: "123E4567-E89B-12D3-A456-426614174000", Comparison: core.Comparison_EQ },
+			{ Property: "ref", Value: "123E4567-E89B-12D3-A456-426614174000", Comparison: core.Comparison_EQ },
+		}, []Column{
+			{ Name: "id", Type: ColType_UUID, Binary: true },
+			{ Name: "ref", Type: ColType_UUID },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{ uuid, "123e4567-e89b-12d3-a456-426614174000" }, args)
+	});
+
+	t.Run("placeholders and typed arguments", func (t *testing.T) {
+		clauses, args, err := constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "age", Value: "30", Comparison: core.Comparison_GE },
+			{ Property: "name", Value: `Robert"); DROP TABLE Users; --`, Comparison: core.Comparison_EQ },
+			{ Property: "active", Value: "true", Comparison: core.Comparison_NE },
+			{ Property: "created_at", Value: "2023-10-01T12:00:00Z", Comparison: core.Comparison_LT },
+		}, columns)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ "`age` >= ?", "`name` = ?", "NOT (`active` <=> ?)", "`created_at` < ?" }, clauses)
+		assert.Equal(t, []interface{}{ int64(30), `Robert"); DROP TABLE Users; --`, 1, "2023-10-01 12:00:00" }, args)
+	});
+
+	t.Run("unknown field", func (t *testing.T) {
+		_, _, err := constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "unknown", Value: "1", Comparison: core.Comparison_EQ },
+		}, columns)
+		assert.Equal(t, core.ErrorKind_VALIDATION, core.KindOf(err))
+	});
+
+	t.Run("invalid value", func (t *testing.T) {
+		_, _, err := constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "age", Value: "thirty", Comparison: core.Comparison_EQ },
+		}, columns)
+		assert.ErrorContains(t, err, "age")
+	});
+
+	t.Run("in comparisons", func (t *testing.T) {
+		clauses, args, err := constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "age", Comparison: core.Comparison_IN, Values: []string{ "1", "2", "3" } },
+			{ Property: "name", Comparison: core.Comparison_IN },
+		}, columns)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ "`age` IN (?,?,?)", "FALSE" }, clauses)
+		assert.Equal(t, []interface{}{ int64(1), int64(2), int64(3) }, args)
+
+		_, _, err = constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "age", Comparison: core.Comparison_IN, Values: []string{ "1", "two" } },
+		}, columns)
+		assert.ErrorContains(t, err, "age")
+	});
+
+	t.Run("null comparisons", func (t *testing.T) {
+		clauses, args, err := constraints_to_sql_clauses([]core.Constraint{
+			{ Property: "name", Comparison: core.Comparison_NULL },
+			{ Property: "age", Comparison: core.Comparison_NOTNULL },
+		}, columns)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ "`name` IS NULL", "`age` IS NOT NULL" }, clauses)
+		assert.Empty(t, args)
+	});
+}
+
+func TestMysqlNullableColumns (t *testing.T) {
+	columns := []Column{
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "location", Type: ColType_STRING, Nullable: true },
+	}
+
+	entry, err := fix_payload_types(map[string]interface{}{ "name": []byte("John"), "location": nil }, columns)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{ "name": "John", "location": nil }, entry)
+
+	_, err = fix_payload_types(map[string]interface{}{ "name": nil, "location": nil }, columns)
+	assert.ErrorContains(t, err, "not nullable")
+}
@@ -0,0 +1,151 @@
+package drivers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/jmoiron/sqlx"
+)
+
+// Build the "INSERT ... ON DUPLICATE KEY UPDATE" statement writing `entry`
+// into `table`. Every field of `entry` but the conflict `keys` is updated
+// when the entry already exists. If `guarded`, the fields are only updated
+// when the existing entry holds the same `keys`, and not when the insertion
+// conflicts on another unique key.
+func upsert_statement (table string, columns []Column, entry map[string]interface{}, keys []string, guarded bool) (string, []interface{}, error) {
+	known := map[string]bool{}
+	for _, c := range columns {
+		known[c.Name] = true
+	}
+	for k := range entry {
+		if !known[k] { return "", nil, core.ValidationErrorf("unknown_field", "unknown field \"%s\"", k).WithField(k, "unknown field") }
+	}
+	is_key := map[string]bool{}
+	for _, k := range keys {
+		if _, exists := entry[k]; !exists { return "", nil, core.ValidationErrorf("missing_field", "entry has no value for the conflict key \"%s\"", k).WithField(k, "missing value") }
+		is_key[k] = true
+	}
+
+	insert_columns := []Column{}
+	args := []interface{}{}
+	for _, c := range columns {
+		value, exists := entry[c.Name]
+		if !exists { continue }
+		arg, err := encode_entry_value(value, c)
+		if err != nil { return "", nil, invalid_value_error(c.Name, err) }
+		insert_columns = append(insert_columns, c)
+		args = append(args, arg)
+	}
+
+	// The keys are never updated, so the condition holds for every field.
+	conditions := []string{}
+	for _, k := range keys {
+		name := quote_identifier(k)
+		conditions = append(conditions, fmt.Sprintf("%s<=>VALUES(%s)", name, name))
+	}
+	updates := []string{}
+	for _, c := range insert_columns {
+		if is_key[c.Name] { continue }
+		name := quote_identifier(c.Name)
+		if guarded {
+			updates = append(updates, fmt.Sprintf("%s=IF(%s,VALUES(%s),%s)", name, strings.Join(conditions, " AND "), name, name))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", name, name))
+		}
+	}
+	if len(updates) == 0 {
+		// Nothing to update, keep the existing entry as is.
+		name := quote_identifier(keys[0])
+		updates = append(updates, fmt.Sprintf("%s=%s", name, name))
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (?%s) ON DUPLICATE KEY UPDATE %s",
+		quote_identifier(table),
+		strings.Join(column_field_names(insert_columns), ","),
+		strings.Repeat(",?", len(insert_columns) - 1),
+		strings.Join(updates, ","),
+	)
+	return query, args, nil
+}
+
+// Insert or update `entry`. The conflict `keys` must be the primary key or a
+// unique key of `table`. MySQL also runs the update when the insertion
+// conflicts on any other unique key of the table, which would overwrite an
+// entry the client was not checked against, e.g. of another tenant: such
+// conflicts are rejected instead.
+func mysql_upsert (db *sqlx.DB, table string, columns []Column, entry map[string]interface{}, keys []string) (bool, error) {
+	if len(keys) == 0 { return false, core.ValidationErrorf("missing_param", "at least one conflict key is required") }
+
+	unique, err := mysql_unique_keys(db, table)
+	if err != nil { return false, err }
+	if !has_index(unique, keys) {
+		return false, core.ValidationErrorf("invalid_param", "conflict key (%s) is not a primary or unique key of \"%s\"", strings.Join(keys, ","), table).WithField("key", "not a primary or unique key")
+	}
+
+	guarded := len(unique) > 1
+	query, args, err := upsert_statement(table, columns, entry, keys, guarded)
+	if err != nil { return false, err }
+	res, err := db.Exec(query, args...)
+	if err != nil { return false, err }
+
+	// MySQL reports 1 affected row for an insertion, 2 for an update and 0
+	// when the existing entry already held the same values, or when the
+	// guarded update did not apply.
+	affected, err := res.RowsAffected()
+	if err != nil { return false, err }
+	if affected == 0 && guarded {
+		query, args, err := unique_conflict_query(table, columns, entry, keys, unique)
+		if err != nil { return false, err }
+		var conflicts int
+		if err := db.Get(&conflicts, query, args...); err != nil { return false, err }
+		if conflicts > 0 { return false, core.ConflictErrorf("duplicate_key", "entry conflicts with an existing entry on another unique key than (%s)", strings.Join(keys, ",")) }
+	}
+	return affected == 1, nil
+}
+
+// Build the query counting the entries of `table` other than the one holding
+// the `keys` of `entry`, which hold the values of `entry` for another of the
+// `unique` keys.
+func unique_conflict_query (table string, columns []Column, entry map[string]interface{}, keys []string, unique [][]string) (string, []interface{}, error) {
+	by_name := map[string]Column{}
+	for _, c := range columns {
+		by_name[strings.ToLower(c.Name)] = c
+	}
+	match := func (index []string) (string, []interface{}, error) {
+		clauses := []string{}
+		args := []interface{}{}
+		for _, name := range index {
+			c, ok := by_name[strings.ToLower(name)]
+			value, held := entry[c.Name]
+			// The entry does not set the whole index.
+			if !ok || !held { return "", nil, nil }
+			arg, err := encode_entry_value(value, c)
+			if err != nil { return "", nil, invalid_value_error(c.Name, err) }
+			clauses = append(clauses, fmt.Sprintf("%s <=> ?", quote_identifier(c.Name)))
+			args = append(args, arg)
+		}
+		return "(" + strings.Join(clauses, " AND ") + ")", args, nil
+	}
+
+	key_clause, args, err := match(keys)
+	if err != nil { return "", nil, err }
+	others := []string{}
+	for _, index := range unique {
+		if has_index([][]string{ index }, keys) { continue }
+		clause, index_args, err := match(index)
+		if err != nil { return "", nil, err }
+		if len(clause) == 0 { continue }
+		others = append(others, clause)
+		args = append(args, index_args...)
+	}
+	if len(others) == 0 { others = append(others, "FALSE") }
+	query := fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s WHERE NOT %s AND (%s)",
+		quote_identifier(table),
+		key_clause,
+		strings.Join(others, " OR "),
+	)
+	return query, args, nil
+}
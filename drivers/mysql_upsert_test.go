@@ -0,0 +1,110 @@
+package drivers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/00startupkit/easyapi.go/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMysqlUpsertStatement (t *testing.T) {
+	columns := []Column{
+		{ Name: "id", Type: ColType_INT, PrimaryKey: true },
+		{ Name: "name", Type: ColType_STRING },
+		{ Name: "location", Type: ColType_STRING, Nullable: true },
+	}
+
+	t.Run("updates every non key field", func (t *testing.T) {
+		query, args, err := upsert_statement("Users", columns, map[string]interface{}{
+			"id": json.Number("1"), "name": "John", "location": nil,
+		}, []string{ "id" }, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "INSERT INTO `Users` (`id`,`name`,`location`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`location`=VALUES(`location`)", query)
+		assert.Equal(t, []interface{}{ int64(1), "John", nil }, args)
+	});
+
+	t.Run("guarded update", func (t *testing.T) {
+		query, _, err := upsert_statement("Users", columns, map[string]interface{}{ "id": 1, "name": "John" }, []string{ "id" }, true)
+		assert.NoError(t, err)
+		assert.Equal(t, "INSERT INTO `Users` (`id`,`name`) VALUES (?,?) ON DUPLICATE KEY UPDATE `name`=IF(`id`<=>VALUES(`id`),VALUES(`name`),`name`)", query)
+	});
+
+	t.Run("only key fields", func (t *testing.T) {
+		query, _, err := upsert_statement("Users", columns, map[string]interface{}{ "id": 1 }, []string{ "id" }, false)
+		assert.NoError(t, err)
+		assert.Equal(t, "INSERT INTO `Users` (`id`) VALUES (?) ON DUPLICATE KEY UPDATE `id`=`id`", query)
+	});
+
+	t.Run("rejected entries", func (t *testing.T) {
+		_, _, err := upsert_statement("Users", columns, map[string]interface{}{ "id": 1, "age": 30 }, []string{ "id" }, false)
+		assert.ErrorContains(t, err, "unknown field")
+		_, _, err = upsert_statement("Users", columns, map[string]interface{}{ "name": "John" }, []string{ "id" }, false)
+		assert.ErrorContains(t, err, "conflict key")
+		_, _, err = upsert_statement("Users", columns, map[string]interface{}{ "id": 1, "name": nil }, []string{ "id" }, false)
+		assert.ErrorContains(t, err, "cannot be null")
+	});
+}
+
+func TestMysqlUniqueConflictQuery (t *testing.T) {
+	columns := []Column{
+		{ Name: "id", Type: ColType_INT, PrimaryKey: true },
+		{ Name: "email", Type: ColType_STRING },
+		{ Name: "tenant", Type: ColType_STRING },
+		{ Name: "name", Type: ColType_STRING },
+	}
+	unique := [][]string{ { "id" }, { "email" }, { "tenant", "name" } }
+
+	query, args, err := unique_conflict_query("Users", columns, map[string]interface{}{ "id": 1, "email": "john@example.com", "name": "John" }, []string{ "id" }, unique)
+	assert.NoError(t, err)
+	// The index on (tenant, name) is not set by the entry.
+	assert.Equal(t, "SELECT COUNT(*) FROM `Users` WHERE NOT (`id` <=> ?) AND ((`email` <=> ?))", query)
+	assert.Equal(t, []interface{}{ int64(1), "john@example.com" }, args)
+
+	query, _, err = unique_conflict_query("Users", columns, map[string]interface{}{ "id": 1, "name": "John" }, []string{ "id" }, unique)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) FROM `Users` WHERE NOT (`id` <=> ?) AND (FALSE)", query)
+}
+
+func TestMysqlUpsertConflicts (t *testing.T) {
+	skip_without_mysql(t)
+	var dbname string = hash("test_database")
+	assert.NoError(t, setup_database(dbname))
+	defer func () { assert.NoError(t, cleanup_database(dbname)) }()
+
+	assert.NoError(t, execute_query(dbname, `CREATE TABLE Users (
+		id int NOT NULL PRIMARY KEY,
+		email varchar(255) NOT NULL UNIQUE,
+		name varchar(255) NOT NULL
+	)`))
+	assert.NoError(t, execute_query(dbname, `INSERT INTO Users VALUES (1, 'john@example.com', 'John'), (2, 'jimmy@example.com', 'Jimmy')`))
+	provider, err := CreateMysqlDataProvider(&MysqlConfig{ Primary: MysqlConnectionString(dbname) }, "Users", []Column{
+		{ Name: "id", Type: ColType_INT, PrimaryKey: true },
+		{ Name: "email", Type: ColType_STRING },
+		{ Name: "name", Type: ColType_STRING },
+	})
+	assert.NoError(t, err)
+
+	// Writing the same values again is not a conflict.
+	created, err := provider.Upsert(map[string]interface{}{ "id": 1, "email": "john@example.com", "name": "John" }, []string{ "id" })
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	// The email of another entry, whether the id exists or not.
+	for _, id := range []int{ 1, 3 } {
+		_, err = provider.Upsert(map[string]interface{}{ "id": id, "email": "jimmy@example.com", "name": "Johnny" }, []string{ "id" })
+		assert.Equal(t, core.ErrorKind_CONFLICT, core.KindOf(err))
+	}
+	entry, err := provider.FindOne([]core.Constraint{{ Property: "id", Value: "2", Comparison: core.Comparison_EQ }})
+	assert.NoError(t, err)
+	if entry != nil { assert.Equal(t, "Jimmy", (*entry)["name"]) }
+}
+
+func TestMysqlIndexMatching (t *testing.T) {
+	unique := [][]string{ { "id" }, { "tenant", "email" } }
+	assert.True(t, has_index(unique, []string{ "id" }))
+	assert.True(t, has_index(unique, []string{ "email", "tenant" }))
+	assert.False(t, has_index(unique, []string{ "email" }))
+	assert.False(t, has_index(unique, []string{ "id", "email" }))
+	assert.False(t, has_index(nil, []string{ "id" }))
+}